@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =========================
+// Async (submit and poll) backend
+// =========================
+
+// asyncBackend talks to services modelled on Azure Read: the upload is
+// answered with 202 and an Operation-Location, which is polled until its
+// status is succeeded or failed.
+type asyncBackend struct {
+	url      string
+	deadline time.Duration // whole job: submit, polls and result
+	interval time.Duration // first poll delay, doubled up to maxPoll
+	maxPoll  time.Duration
+	auth     *httpAuth
+	client   *http.Client
+}
+
+func newAsyncBackend(c *backendConfig, auth *httpAuth) (*asyncBackend, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("async backend needs a url")
+	}
+	b := &asyncBackend{
+		url:      c.URL,
+		deadline: c.timeout(120 * time.Second),
+		interval: time.Duration(c.PollInterval),
+		maxPoll:  time.Duration(c.PollMax),
+		auth:     auth,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if b.interval <= 0 {
+		b.interval = 500 * time.Millisecond
+	}
+	if b.maxPoll <= 0 {
+		b.maxPoll = 5 * time.Second
+	}
+	if b.maxPoll < b.interval {
+		b.maxPoll = b.interval
+	}
+	return b, nil
+}
+
+func (b *asyncBackend) String() string { return b.name() + " (async)" }
+
+// name is the URL as logged and stored with results, secrets hidden.
+func (b *asyncBackend) name() string { return redactURL(b.url, b.auth) }
+
+func (b *asyncBackend) recognize(ctx context.Context, pngBytes []byte) (*ocrResult, error) {
+	job, cancel := context.WithTimeout(ctx, b.deadline)
+	defer cancel()
+	start := time.Now()
+
+	res, err := b.run(job, pngBytes)
+	elapsed := time.Since(start)
+	if err != nil {
+		// Tell our deadline apart from the caller giving up.
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if errors.Is(job.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("async OCR: no result within %s", b.deadline)
+		}
+		fmt.Printf("[OCR] %s returned: error (%.3fs)\n", b.name(), elapsed.Seconds())
+		return nil, b.auth.scrubErr(err)
+	}
+	fmt.Printf("[OCR] %s returned: done (%.3fs)\n", b.name(), elapsed.Seconds())
+	res.Backend = b.name()
+	res.Latency = elapsed
+	return res, nil
+}
+
+func (b *asyncBackend) run(ctx context.Context, pngBytes []byte) (*ocrResult, error) {
+	resp, body, err := b.submit(ctx, pngBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// A service may answer small jobs right away.
+	if resp.StatusCode == http.StatusOK {
+		return parseAsyncResult(body)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("submit: HTTP %d: %s", resp.StatusCode, truncate(body, 800))
+	}
+	op := resp.Header.Get("Operation-Location")
+	if op == "" {
+		op = resp.Header.Get("Location")
+	}
+	if op == "" {
+		return nil, fmt.Errorf("submit: 202 without Operation-Location")
+	}
+	opURL, err := resolveURL(b.url, op)
+	if err != nil {
+		return nil, err
+	}
+	// Credentials only go back to the host they were meant for.
+	pollAuth := b.auth
+	if !sameHost(b.url, opURL) {
+		pollAuth = nil
+	}
+
+	delay := retryAfter(resp.Header, b.interval)
+	next := b.interval
+	for polls := 1; ; polls++ {
+		if err := sleepCtx(ctx, delay); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", opURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if err := pollAuth.apply(req); err != nil {
+			return nil, err
+		}
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		next = time.Duration(math.Min(float64(next)*2, float64(b.maxPoll)))
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			delay = retryAfter(resp.Header, next)
+			continue
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			return nil, fmt.Errorf("poll: HTTP %d: %s", resp.StatusCode, truncate(body, 800))
+		}
+
+		var st struct {
+			Status string `json:"status"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &st); err != nil {
+			return nil, fmt.Errorf("poll: %w", err)
+		}
+		switch strings.ToLower(st.Status) {
+		case "succeeded", "success", "done", "completed":
+			fmt.Printf("[OCR] %s: done after %d poll(s)\n", b.name(), polls)
+			return parseAsyncResult(body)
+		case "failed", "error", "canceled", "cancelled":
+			if st.Error != nil && st.Error.Message != "" {
+				return nil, fmt.Errorf("async OCR %s: %s", st.Status, st.Error.Message)
+			}
+			return nil, fmt.Errorf("async OCR %s", st.Status)
+		}
+		delay = retryAfter(resp.Header, next)
+	}
+}
+
+// submit uploads the image, retrying 429 and 503 answers after their
+// Retry-After (or a growing delay) until ctx ends.
+func (b *asyncBackend) submit(ctx context.Context, pngBytes []byte) (*http.Response, []byte, error) {
+	next := b.interval
+	for {
+		req, err := http.NewRequestWithContext(ctx, "POST", b.url, bytes.NewReader(pngBytes))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Accept", "application/json")
+		if err := b.auth.apply(req); err != nil {
+			return nil, nil, err
+		}
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := readBody(resp)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, body, nil
+		}
+		delay := retryAfter(resp.Header, next)
+		fmt.Printf("[OCR] %s: submit got %d, retrying in %s\n", b.name(), resp.StatusCode, delay)
+		if err := sleepCtx(ctx, delay); err != nil {
+			return nil, nil, err
+		}
+		next = min(next*2, b.maxPoll)
+	}
+}
+
+// parseAsyncResult reads a finished job: Azure Read's analyzeResult, or
+// the ocr_result / ocr_boxes of the upload servers.
+func parseAsyncResult(body []byte) (*ocrResult, error) {
+	var out struct {
+		AnalyzeResult *struct {
+			ReadResults []struct {
+				Lines []struct {
+					Text        string    `json:"text"`
+					BoundingBox []float64 `json:"boundingBox"` // x,y of 4 corners
+				} `json:"lines"`
+			} `json:"readResults"`
+		} `json:"analyzeResult"`
+		OCRResult *string  `json:"ocr_result"`
+		OCRBoxes  []ocrBox `json:"ocr_boxes"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	if out.OCRResult != nil {
+		return &ocrResult{Text: *out.OCRResult, Boxes: out.OCRBoxes}, nil
+	}
+	if out.AnalyzeResult == nil {
+		return nil, fmt.Errorf("no analyzeResult or ocr_result in response")
+	}
+	res := &ocrResult{}
+	var lines []string
+	for _, page := range out.AnalyzeResult.ReadResults {
+		for _, l := range page.Lines {
+			lines = append(lines, l.Text)
+			box := ocrBox{Text: l.Text}
+			if bb := l.BoundingBox; len(bb) == 8 {
+				minX := math.Min(math.Min(bb[0], bb[2]), math.Min(bb[4], bb[6]))
+				maxX := math.Max(math.Max(bb[0], bb[2]), math.Max(bb[4], bb[6]))
+				minY := math.Min(math.Min(bb[1], bb[3]), math.Min(bb[5], bb[7]))
+				maxY := math.Max(math.Max(bb[1], bb[3]), math.Max(bb[5], bb[7]))
+				box.X, box.Y, box.W, box.H = minX, minY, maxX-minX, maxY-minY
+			}
+			res.Boxes = append(res.Boxes, box)
+		}
+	}
+	res.Text = strings.Join(lines, "\n")
+	return res, nil
+}
+
+// retryAfter is the delay a Retry-After header asks for (seconds or an
+// HTTP date), def without one.
+func retryAfter(h http.Header, def time.Duration) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return def
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(t))
+	}
+	return def
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("bad Operation-Location %q: %w", ref, err)
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+func sameHost(a, b string) bool {
+	ua, err1 := url.Parse(a)
+	ub, err2 := url.Parse(b)
+	return err1 == nil && err2 == nil && ua.Scheme == ub.Scheme && strings.EqualFold(ua.Host, ub.Host)
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		b = b[:n]
+	}
+	return string(b)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const azureDone = `{"status":"succeeded","analyzeResult":{"readResults":[{"lines":[
+	{"text":"Hello world","boundingBox":[10,10,130,12,128,32,9,30]},
+	{"text":"second","boundingBox":[10,40,50,40,50,60,10,60]}]}]}}`
+
+func TestAsyncBackend(t *testing.T) {
+	// steps answers the n-th request (0-based) of a job; the last one repeats.
+	type step struct {
+		method string
+		code   int
+		header map[string]string
+		body   string
+	}
+	accepted := step{"POST", 202, map[string]string{"Operation-Location": "/operations/1", "Retry-After": "0"}, ""}
+	running := step{"GET", 200, nil, `{"status":"running"}`}
+	tests := []struct {
+		name    string
+		steps   []step
+		timeout time.Duration
+		text    string
+		wantErr string
+	}{
+		{"immediate result", []step{{"POST", 200, nil, `{"ocr_result":"Hello world\nsecond"}`}}, 0, "Hello world\nsecond", ""},
+		{"polled", []step{accepted, running, running, {"GET", 200, nil, azureDone}}, 0, "Hello world\nsecond", ""},
+		{"submit throttled", []step{
+			{"POST", 429, map[string]string{"Retry-After": "0"}, "slow down"},
+			{"POST", 503, nil, "busy"},
+			accepted, {"GET", 200, nil, azureDone}}, 0, "Hello world\nsecond", ""},
+		{"poll throttled", []step{accepted, {"GET", 429, nil, ""}, {"GET", 200, nil, azureDone}}, 0, "Hello world\nsecond", ""},
+		{"failed", []step{accepted, {"GET", 200, nil, `{"status":"failed","error":{"message":"bad image"}}`}}, 0, "", "async OCR failed: bad image"},
+		{"submit rejected", []step{{"POST", 400, nil, "unsupported"}}, 0, "", "submit: HTTP 400: unsupported"},
+		{"no location", []step{{"POST", 202, nil, ""}}, 0, "", "202 without Operation-Location"},
+		{"deadline", []step{accepted, running}, 100 * time.Millisecond, "", "no result within 100ms"},
+		{"throttled past the deadline", []step{{"POST", 429, nil, ""}}, 100 * time.Millisecond, "", "no result within 100ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(n.Add(1)) - 1
+				s := tt.steps[min(i, len(tt.steps)-1)]
+				if r.Method != s.method {
+					t.Errorf("request %d: %s %s, want %s", i, r.Method, r.URL.Path, s.method)
+				}
+				for k, v := range s.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(s.code)
+				w.Write([]byte(s.body))
+			}))
+			defer srv.Close()
+
+			c := &backendConfig{Type: backendAsync, URL: srv.URL + "/read", Timeout: duration(tt.timeout),
+				PollInterval: duration(time.Millisecond), PollMax: duration(4 * time.Millisecond)}
+			backends, err := newBackends(c, "default", nil, newCredentialStore(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := backends[0].recognize(context.Background(), testPNG(t, 4, 4))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Text != tt.text {
+				t.Errorf("text = %q, want %q", res.Text, tt.text)
+			}
+		})
+	}
+}
+
+func TestAsyncBackendAuth(t *testing.T) {
+	var pollAuth atomic.Value
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pollAuth.Store(r.Header.Get("Ocp-Apim-Subscription-Key") + "|" + r.URL.RawQuery)
+		w.Write([]byte(azureDone))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "azure-key-7" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Operation-Location", other.URL+"/operations/1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	t.Setenv("OCR_TEST_KEY", "azure-key-7")
+	c := &backendConfig{Type: backendAsync, URL: strings.Replace(srv.URL, "http://", "http://me:hunter2@", 1) + "/read?sig=abc123&lang=en",
+		PollInterval: duration(time.Millisecond),
+		Auth:         &authConfig{Type: authHeader, Header: "Ocp-Apim-Subscription-Key", Token: "env:OCR_TEST_KEY"}}
+	backends, err := newBackends(c, "default", nil, newCredentialStore(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := backends[0].recognize(context.Background(), testPNG(t, 4, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pollAuth.Load(); got != "|" {
+		t.Errorf("credentials sent to the other host: %q", got)
+	}
+	for _, s := range []string{res.Backend, backends[0].String()} {
+		if strings.Contains(s, "hunter2") || strings.Contains(s, "abc123") || !strings.Contains(s, "lang=en") {
+			t.Errorf("backend shown as %q", s)
+		}
+	}
+	want := []ocrBox{
+		{Text: "Hello world", X: 9, Y: 10, W: 121, H: 22},
+		{Text: "second", X: 10, Y: 40, W: 40, H: 20},
+	}
+	if !reflect.DeepEqual(res.Boxes, want) {
+		t.Errorf("boxes = %+v\nwant %+v", res.Boxes, want)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", time.Second},
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"soon", time.Second},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0}, // in the past
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.value != "" {
+			h.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(h, time.Second); got != tt.want {
+			t.Errorf("Retry-After %q = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
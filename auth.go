@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// =========================
+// Backend authentication
+// =========================
+
+// Auth types.
+const (
+	authBearer = "bearer" // Authorization: Bearer <token>
+	authBasic  = "basic"  // Authorization: Basic user:password
+	authHeader = "header" // <header>: <token>, default header X-API-Key
+	authQuery  = "query"  // ?<param>=<token>, default param api_key
+)
+
+// authConfig is a backend's "auth" section. Token and Password are secret
+// references: "env:NAME" reads an environment variable, "cred:NAME" an
+// entry of the credentials file. Anything else is used as written.
+type authConfig struct {
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Param    string `json:"param,omitempty"`
+}
+
+// credentialStore reads the credentials file, a JSON object of name to
+// secret, the first time a "cred:" reference needs it.
+type credentialStore struct {
+	path    string
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func newCredentialStore(path string) *credentialStore {
+	if path == "" {
+		path = filepath.Join(configDir(), "credentials.json")
+	}
+	return &credentialStore{path: path}
+}
+
+func (s *credentialStore) get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.secrets == nil {
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return "", fmt.Errorf("credentials: %w", err)
+		}
+		var secrets map[string]string
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return "", fmt.Errorf("credentials %s: %w", s.path, err)
+		}
+		s.secrets = secrets
+	}
+	v, ok := s.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("credentials %s: no entry %q", s.path, name)
+	}
+	return v, nil
+}
+
+// resolve turns a secret reference into its value.
+func (s *credentialStore) resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := ref[len("env:"):]
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(ref, "cred:"):
+		return s.get(ref[len("cred:"):])
+	}
+	return ref, nil
+}
+
+// httpAuth adds credentials and static headers to a backend's requests
+// and scrubs the secrets from anything that is logged or shown. Secret
+// references are resolved on the first request, not when the config
+// loads, so commands that never call the backend (history) work without
+// them; a failed resolve is retried on the next request.
+type httpAuth struct {
+	conf  *authConfig
+	refs  map[string]string // static headers as configured
+	creds *credentialStore
+
+	mu      sync.Mutex
+	ready   bool
+	headers http.Header
+	query   [2]string // param, value; empty without query auth
+	secrets []string
+}
+
+// newHTTPAuth checks c without resolving any secret.
+func newHTTPAuth(c *authConfig, headers map[string]string, creds *credentialStore) (*httpAuth, error) {
+	if c == nil && len(headers) == 0 {
+		return nil, nil
+	}
+	if c != nil {
+		switch c.Type {
+		case authBearer, authHeader, authQuery:
+			if c.Token == "" {
+				return nil, fmt.Errorf("auth %s needs a token", c.Type)
+			}
+		case authBasic:
+			if c.Password == "" {
+				return nil, fmt.Errorf("auth %s needs a password", c.Type)
+			}
+		default:
+			return nil, fmt.Errorf("unknown auth type %q (want bearer, basic, header or query)", c.Type)
+		}
+	}
+	return &httpAuth{conf: c, refs: headers, creds: creds}, nil
+}
+
+// resolve looks the secrets up once. Callers hold a.mu.
+func (a *httpAuth) resolve() error {
+	if a.ready {
+		return nil
+	}
+	headers := make(http.Header)
+	var query [2]string
+	var secrets []string
+	for k, v := range a.refs {
+		val, err := a.creds.resolve(v)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+		if val != v {
+			secrets = append(secrets, val) // came from a reference
+		}
+		headers.Set(k, val)
+	}
+	if c := a.conf; c != nil {
+		ref := c.Token
+		if c.Type == authBasic {
+			ref = c.Password
+		}
+		v, err := a.creds.resolve(ref)
+		if err != nil {
+			if c.Type == authBasic {
+				return fmt.Errorf("auth password: %w", err)
+			}
+			return fmt.Errorf("auth token: %w", err)
+		}
+		secrets = append(secrets, v)
+		switch c.Type {
+		case authBearer:
+			headers.Set("Authorization", "Bearer "+v)
+		case authBasic:
+			enc := base64.StdEncoding.EncodeToString([]byte(c.User + ":" + v))
+			secrets = append(secrets, enc)
+			headers.Set("Authorization", "Basic "+enc)
+		case authHeader:
+			name := c.Header
+			if name == "" {
+				name = "X-API-Key"
+			}
+			headers.Set(name, v)
+		case authQuery:
+			param := c.Param
+			if param == "" {
+				param = "api_key"
+			}
+			query = [2]string{param, v}
+		}
+	}
+	a.headers, a.query, a.secrets, a.ready = headers, query, secrets, true
+	return nil
+}
+
+// apply adds the credentials to req, resolving them on first use. A nil
+// httpAuth does nothing.
+func (a *httpAuth) apply(req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.resolve(); err != nil {
+		return err
+	}
+	for k, v := range a.headers {
+		req.Header[k] = v
+	}
+	if a.query[0] != "" {
+		q := req.URL.Query()
+		q.Set(a.query[0], a.query[1])
+		req.URL.RawQuery = q.Encode()
+	}
+	return nil
+}
+
+// withSecret returns a resolved copy of a that also scrubs v, for a
+// secret sent some other way (in a request body).
+func (a *httpAuth) withSecret(v string) (*httpAuth, error) {
+	out := &httpAuth{ready: true, secrets: []string{v}}
+	if a != nil {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if err := a.resolve(); err != nil {
+			return nil, err
+		}
+		out.headers, out.query = a.headers, a.query
+		out.secrets = append(out.secrets, a.secrets...)
+	}
+	return out, nil
+}
+
+// scrub replaces every secret in s, raw or URL-encoded.
+func (a *httpAuth) scrub(s string) string {
+	if a == nil {
+		return s
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, v := range a.secrets {
+		if v == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, v, "[REDACTED]")
+		if q := url.QueryEscape(v); q != v {
+			s = strings.ReplaceAll(s, q, "[REDACTED]")
+		}
+	}
+	return s
+}
+
+// scrubErr returns err with its secrets scrubbed from the message. It
+// still unwraps to err, so errors.Is keeps working.
+func (a *httpAuth) scrubErr(err error) error {
+	if a == nil || err == nil {
+		return err
+	}
+	msg := a.scrub(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &scrubbedError{msg: msg, err: err}
+}
+
+// secretParams are query parameters whose values redactURL hides even
+// when they were written into the URL rather than configured as auth.
+var secretParams = []string{"key", "api_key", "apikey", "api-key", "token", "access_token",
+	"subscription-key", "code", "sig", "signature", "password"}
+
+// redactURL is raw fit for logs and results: the password of a
+// user:pass@host, secret query parameters and a's secrets are replaced.
+func redactURL(raw string, a *httpAuth) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return a.scrub(raw)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if slices.ContainsFunc(secretParams, func(p string) bool { return strings.EqualFold(p, k) }) {
+				q.Set(k, "REDACTED")
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return a.scrub(u.Redacted())
+}
+
+type scrubbedError struct {
+	msg string
+	err error
+}
+
+func (e *scrubbedError) Error() string { return e.msg }
+func (e *scrubbedError) Unwrap() error { return e.err }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// =========================
+// Backend config
+// =========================
+
+// Backend types.
+const (
+	backendServer    = "server"    // macocr / iOS-OCR-Server upload (default)
+	backendOpenAI    = "openai"    // OpenAI-compatible chat completions with a vision model
+	backendTesseract = "tesseract" // local tesseract binary
+	backendAsync     = "async"     // submit, then poll an operation URL (Azure Read style)
+)
+
+// backendConfig is the per-profile "backend" section. Without it, a
+// profile uploads to its servers (or the -url servers).
+type backendConfig struct {
+	Type string `json:"type,omitempty"`
+	URL  string `json:"url,omitempty"`
+
+	// Timeout bounds one upload (server, default 60s), one chat request
+	// (openai, 120s), one tesseract run (60s), or the whole job, submit
+	// and polls together (async, 120s).
+	Timeout duration `json:"timeout,omitempty"`
+
+	// HTTP backends (server, openai, async)
+	Auth    *authConfig       `json:"auth,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // values may be secret references
+
+	// openai
+	Model       string   `json:"model,omitempty"`
+	System      string   `json:"system,omitempty"`
+	Prompt      string   `json:"prompt,omitempty"` // built-in prompt name or text/template
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+
+	// tesseract
+	Path      string   `json:"path,omitempty"`      // binary, default "tesseract" on PATH
+	Languages []string `json:"languages,omitempty"` // e.g. ["eng", "chi_tra"]
+	PSM       *int     `json:"psm,omitempty"`
+	OEM       *int     `json:"oem,omitempty"`
+	Args      []string `json:"args,omitempty"`  // extra arguments, e.g. ["-c", "preserve_interword_spaces=1"]
+	Input     string   `json:"input,omitempty"` // "stdin" (default) or "file"
+	Boxes     string   `json:"boxes,omitempty"` // "line" (default) or "word"
+
+	// async
+	PollInterval duration `json:"poll_interval,omitempty"` // first poll delay, default 500ms
+	PollMax      duration `json:"poll_max,omitempty"`      // backoff cap, default 5s
+}
+
+// newBackends builds the backends of a profile; servers are its (or the
+// command line's) server URLs.
+func newBackends(c *backendConfig, profile string, servers []string, creds *credentialStore) ([]ocrBackend, error) {
+	if c == nil {
+		c = &backendConfig{}
+	}
+	auth, err := newHTTPAuth(c.Auth, c.Headers, creds)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil && c.Type == backendTesseract {
+		return nil, fmt.Errorf("auth and headers only apply to HTTP backends")
+	}
+	var b ocrBackend
+	switch c.Type {
+	case "", backendServer:
+		if c.URL != "" {
+			servers = []string{c.URL}
+		}
+		return serverBackends(servers, auth, c.timeout(60*time.Second)), nil
+	case backendOpenAI:
+		b, err = newOpenAIBackend(c, profile, auth)
+	case backendTesseract:
+		b, err = newTesseractBackend(c)
+	case backendAsync:
+		b, err = newAsyncBackend(c, auth)
+	default:
+		return nil, fmt.Errorf("unknown type %q (want server, openai, tesseract or async)", c.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []ocrBackend{b}, nil
+}
+
+// timeout is the configured Timeout, def when unset.
+func (c *backendConfig) timeout(def time.Duration) time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout)
+	}
+	return def
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/makiuchi-d/gozxing"
+	multiqr "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+// =========================
+// Barcodes
+// =========================
+
+// Barcode modes: what happens to the OCR upload.
+const (
+	barcodeFirst = "first" // OCR only when no symbol is found (default)
+	barcodeAlso  = "also"  // always OCR; payloads come before the text
+	barcodeOnly  = "only"  // never OCR
+)
+
+// barcodeConfig is the per-profile "barcode" section. The crop is scanned
+// locally for symbols before it would be uploaded.
+type barcodeConfig struct {
+	Mode    string   `json:"mode,omitempty"`
+	Formats []string `json:"formats,omitempty"` // default: all of barcodeFormats
+}
+
+// barcodeFormats are the symbologies that can be decoded, by config name.
+var barcodeFormats = map[string]gozxing.BarcodeFormat{
+	"qr":      gozxing.BarcodeFormat_QR_CODE,
+	"code128": gozxing.BarcodeFormat_CODE_128,
+	"ean13":   gozxing.BarcodeFormat_EAN_13,
+	"code39":  gozxing.BarcodeFormat_CODE_39,
+}
+
+var barcodeNames = map[gozxing.BarcodeFormat]string{
+	gozxing.BarcodeFormat_QR_CODE:  "qr",
+	gozxing.BarcodeFormat_CODE_128: "code128",
+	gozxing.BarcodeFormat_EAN_13:   "ean13",
+	gozxing.BarcodeFormat_CODE_39:  "code39",
+}
+
+// barcodeScanner decodes the formats of one profile.
+type barcodeScanner struct {
+	mode    string
+	formats map[gozxing.BarcodeFormat]bool
+}
+
+func (c *barcodeConfig) compile() (*barcodeScanner, error) {
+	if c == nil {
+		return nil, nil
+	}
+	s := &barcodeScanner{mode: c.Mode, formats: make(map[gozxing.BarcodeFormat]bool)}
+	switch s.mode {
+	case "":
+		s.mode = barcodeFirst
+	case barcodeFirst, barcodeAlso, barcodeOnly:
+	default:
+		return nil, fmt.Errorf("unknown mode %q (want first, also or only)", c.Mode)
+	}
+	names := c.Formats
+	if len(names) == 0 {
+		names = []string{"qr", "code128", "ean13", "code39"}
+	}
+	for _, n := range names {
+		f, ok := barcodeFormats[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown format %q (want qr, code128, ean13 or code39)", n)
+		}
+		s.formats[f] = true
+	}
+	return s, nil
+}
+
+// barcodeSymbol is one decoded symbol with its bounds in image pixels.
+type barcodeSymbol struct {
+	format  string
+	payload string
+	bounds  image.Rectangle
+}
+
+// decode returns every symbol found in img, QR codes first. Screens show
+// codes light-on-dark as often as dark-on-light, so an image without a
+// hit is tried again inverted.
+func (s *barcodeScanner) decode(img image.Image) []barcodeSymbol {
+	src := gozxing.NewLuminanceSourceFromImage(img)
+	syms := s.decodeSource(src)
+	if len(syms) == 0 {
+		syms = s.decodeSource(gozxing.NewInvertedLuminanceSource(src))
+	}
+	return syms
+}
+
+func (s *barcodeScanner) decodeSource(src gozxing.LuminanceSource) []barcodeSymbol {
+	var out []barcodeSymbol
+	add := func(r *gozxing.Result) {
+		for _, o := range out {
+			if o.payload == r.GetText() {
+				return
+			}
+		}
+		out = append(out, barcodeSymbol{
+			format:  barcodeNames[r.GetBarcodeFormat()],
+			payload: r.GetText(),
+			bounds:  pointBounds(r.GetResultPoints()),
+		})
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+
+	if s.formats[gozxing.BarcodeFormat_QR_CODE] {
+		if bmp, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(src)); err == nil {
+			results, _ := multiqr.NewQRCodeMultiReader().DecodeMultiple(bmp, hints)
+			for _, r := range results {
+				add(r)
+			}
+		}
+	}
+
+	readers := []struct {
+		format gozxing.BarcodeFormat
+		reader func() gozxing.Reader
+	}{
+		{gozxing.BarcodeFormat_CODE_128, oned.NewCode128Reader},
+		{gozxing.BarcodeFormat_EAN_13, oned.NewEAN13Reader},
+		{gozxing.BarcodeFormat_CODE_39, oned.NewCode39Reader},
+	}
+	for _, r := range readers {
+		if !s.formats[r.format] {
+			continue
+		}
+		// 1D readers scan rows and do better on the global binarizer.
+		bmp, err := gozxing.NewBinaryBitmap(gozxing.NewGlobalHistgramBinarizer(src))
+		if err != nil {
+			continue
+		}
+		if res, err := r.reader().Decode(bmp, hints); err == nil {
+			add(res)
+		}
+	}
+	return out
+}
+
+func pointBounds(pts []gozxing.ResultPoint) image.Rectangle {
+	if len(pts) == 0 {
+		return image.Rectangle{}
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range pts {
+		minX, maxX = math.Min(minX, p.GetX()), math.Max(maxX, p.GetX())
+		minY, maxY = math.Min(minY, p.GetY()), math.Max(maxY, p.GetY())
+	}
+	return image.Rect(int(minX), int(minY), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// skipOCR reports whether the upload can be left out.
+func (s *barcodeScanner) skipOCR(found bool) bool {
+	return s != nil && (s.mode == barcodeOnly || s.mode == barcodeFirst && found)
+}
+
+// barcodeResult turns symbols into a result: one payload per line.
+func barcodeResult(syms []barcodeSymbol, latency time.Duration) *ocrResult {
+	res := &ocrResult{Backend: "barcode", Latency: latency}
+	var lines []string
+	for _, s := range syms {
+		lines = append(lines, s.payload)
+		res.Boxes = append(res.Boxes, ocrBox{
+			Text: s.payload,
+			X:    float64(s.bounds.Min.X),
+			Y:    float64(s.bounds.Min.Y),
+			W:    float64(s.bounds.Dx()),
+			H:    float64(s.bounds.Dy()),
+		})
+		fmt.Printf("[OCR] Barcode: found %s (%d bytes)\n", s.format, len(s.payload))
+	}
+	res.Text = strings.Join(lines, "\n")
+	return res
+}
+
+// withBarcodes puts the payloads of codes before the OCR text of res.
+func withBarcodes(codes, res *ocrResult) *ocrResult {
+	if codes == nil || codes.Text == "" {
+		return res
+	}
+	out := *res
+	out.Text = codes.Text
+	if res.Text != "" {
+		out.Text += "\n\n" + res.Text
+	}
+	out.Boxes = append(append([]ocrBox(nil), codes.Boxes...), res.Boxes...)
+	out.Backend = "barcode, " + res.Backend
+	out.Latency += codes.Latency
+	out.Redacted = out.Redacted || codes.Redacted
+	return &out
+}
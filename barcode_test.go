@@ -0,0 +1,143 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// encodeSymbol renders payload with the gozxing writer for format.
+func encodeSymbol(t *testing.T, format gozxing.BarcodeFormat, payload string, w, h int) image.Image {
+	t.Helper()
+	writers := map[gozxing.BarcodeFormat]gozxing.Writer{
+		gozxing.BarcodeFormat_QR_CODE:  qrcode.NewQRCodeWriter(),
+		gozxing.BarcodeFormat_CODE_128: oned.NewCode128Writer(),
+		gozxing.BarcodeFormat_EAN_13:   oned.NewEAN13Writer(),
+		gozxing.BarcodeFormat_CODE_39:  oned.NewCode39Writer(),
+	}
+	m, err := writers[format].Encode(payload, format, w, h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// screenshot places symbols on a white (or, inverted, dark) page at the
+// given points, like a crop of a web page or a terminal.
+func screenshot(w, h int, inverted bool, syms map[image.Point]image.Image) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for at, s := range syms {
+		draw.Draw(img, s.Bounds().Add(at), s, image.Point{}, draw.Src)
+	}
+	if inverted {
+		for i := range img.Pix {
+			if i%4 != 3 {
+				img.Pix[i] = 0xFF - img.Pix[i]
+			}
+		}
+	}
+	return img
+}
+
+func TestBarcodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   gozxing.BarcodeFormat
+		payload  string
+		w, h     int
+		inverted bool
+	}{
+		{"qr url", gozxing.BarcodeFormat_QR_CODE, "https://example.com/login?otp=123456", 200, 200, false},
+		{"qr unicode", gozxing.BarcodeFormat_QR_CODE, "光學字元辨識 OCR", 200, 200, false},
+		{"qr dark mode", gozxing.BarcodeFormat_QR_CODE, "WIFI:S:office;T:WPA;P:secret;;", 200, 200, true},
+		{"code128", gozxing.BarcodeFormat_CODE_128, "INV-2024-0017", 300, 80, false},
+		{"ean13", gozxing.BarcodeFormat_EAN_13, "4006381333931", 300, 80, false},
+		{"code39", gozxing.BarcodeFormat_CODE_39, "PART-42X", 300, 80, false},
+	}
+	s, err := (&barcodeConfig{}).compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sym := encodeSymbol(t, tt.format, tt.payload, tt.w, tt.h)
+			img := screenshot(tt.w+80, tt.h+60, tt.inverted, map[image.Point]image.Image{{40, 30}: sym})
+			got := s.decode(img)
+			if len(got) != 1 {
+				t.Fatalf("found %d symbols, want 1", len(got))
+			}
+			if got[0].payload != tt.payload || got[0].format != barcodeNames[tt.format] {
+				t.Errorf("got %s %q, want %s %q", got[0].format, got[0].payload, barcodeNames[tt.format], tt.payload)
+			}
+			// 1D readers report points on the scanned row: the bounds may
+			// have no height, but they lie on the symbol.
+			if r := sym.Bounds().Add(image.Pt(40, 30)); !got[0].bounds.Min.In(r) || got[0].bounds.Max.X > r.Max.X {
+				t.Errorf("bounds %v outside the symbol at %v", got[0].bounds, r)
+			}
+		})
+	}
+}
+
+func TestBarcodeFormatsAndModes(t *testing.T) {
+	qr1 := encodeSymbol(t, gozxing.BarcodeFormat_QR_CODE, "first", 150, 150)
+	qr2 := encodeSymbol(t, gozxing.BarcodeFormat_QR_CODE, "second", 150, 150)
+	img := screenshot(400, 200, false, map[image.Point]image.Image{{20, 20}: qr1, {220, 20}: qr2})
+
+	all, _ := (&barcodeConfig{}).compile()
+	var payloads []string
+	for _, sym := range all.decode(img) {
+		payloads = append(payloads, sym.payload)
+	}
+	if len(payloads) != 2 {
+		t.Errorf("payloads %q, want both codes", payloads)
+	}
+
+	only1D, _ := (&barcodeConfig{Formats: []string{"code128"}}).compile()
+	if got := only1D.decode(img); len(got) != 0 {
+		t.Errorf("code128-only scanner found %v", got)
+	}
+
+	tests := []struct {
+		mode  string
+		found bool
+		skip  bool
+	}{
+		{"", true, true},
+		{"", false, false},
+		{barcodeAlso, true, false},
+		{barcodeOnly, false, true},
+	}
+	for _, tt := range tests {
+		s, err := (&barcodeConfig{Mode: tt.mode}).compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.skipOCR(tt.found); got != tt.skip {
+			t.Errorf("mode %q, found %v: skipOCR = %v, want %v", tt.mode, tt.found, got, tt.skip)
+		}
+	}
+	if _, err := (&barcodeConfig{Formats: []string{"pdf417"}}).compile(); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestWithBarcodes(t *testing.T) {
+	codes := barcodeResult([]barcodeSymbol{{format: "qr", payload: "https://example.com", bounds: image.Rect(1, 2, 11, 12)}}, 5)
+	res := withBarcodes(codes, &ocrResult{Text: "Scan to pay", Backend: "server", Latency: 10, Boxes: []ocrBox{{Text: "Scan to pay"}}})
+	want := &ocrResult{
+		Text:    "https://example.com\n\nScan to pay",
+		Backend: "barcode, server",
+		Latency: 15,
+		Boxes:   []ocrBox{{Text: "https://example.com", X: 1, Y: 2, W: 10, H: 10}, {Text: "Scan to pay"}},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/longbridgeapp/opencc"
+)
+
+// =========================
+// Chinese conversion (OpenCC)
+// =========================
+
+// zhConversions lists the supported OpenCC conversions. The phrase tables
+// ship embedded in the opencc package, so longest-phrase matching works
+// without any files next to the binary.
+var zhConversions = map[string]string{
+	"s2t":   "Simplified to Traditional",
+	"t2s":   "Traditional to Simplified",
+	"s2tw":  "Simplified to Traditional (Taiwan)",
+	"tw2s":  "Traditional (Taiwan) to Simplified",
+	"s2twp": "Simplified to Traditional (Taiwan, with phrases)",
+	"tw2sp": "Traditional (Taiwan, with phrases) to Simplified",
+	"s2hk":  "Simplified to Traditional (Hong Kong)",
+	"hk2s":  "Traditional (Hong Kong) to Simplified",
+	"t2tw":  "Traditional to Taiwan standard",
+	"t2hk":  "Traditional to Hong Kong standard",
+}
+
+// Building the dictionaries takes a moment, so each converter is built on
+// first use and shared.
+var (
+	zhMu         sync.Mutex
+	zhConverters = map[string]*opencc.OpenCC{}
+)
+
+func checkZhConversion(name string) error {
+	if _, ok := zhConversions[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("unknown conversion %q (want one of %s)", name, strings.Join(zhConversionNames(), ", "))
+	}
+	return nil
+}
+
+func zhConverter(name string) (*opencc.OpenCC, error) {
+	if err := checkZhConversion(name); err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+	zhMu.Lock()
+	defer zhMu.Unlock()
+	if cc := zhConverters[name]; cc != nil {
+		return cc, nil
+	}
+	cc, err := opencc.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("conversion %s: %w", name, err)
+	}
+	zhConverters[name] = cc
+	return cc, nil
+}
+
+func zhConversionNames() []string {
+	names := make([]string, 0, len(zhConversions))
+	for n := range zhConversions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// convertChinese converts s with the named conversion.
+func convertChinese(name, s string) (string, error) {
+	cc, err := zhConverter(name)
+	if err != nil {
+		return "", err
+	}
+	return cc.Convert(s)
+}
+
+// zhStep is the post-processing step for a conversion. The name is checked
+// up front; the dictionaries are only loaded when the step first runs. On a
+// conversion error the text is passed through unchanged.
+func zhStep(name string) (textStep, error) {
+	if err := checkZhConversion(name); err != nil {
+		return nil, err
+	}
+	return func(s string) string {
+		out, err := convertChinese(name, s)
+		if err != nil {
+			fmt.Printf("[OCR] Chinese conversion failed: %v\n", err)
+			return s
+		}
+		return out
+	}, nil
+}
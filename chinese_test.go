@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertChinese(t *testing.T) {
+	tests := []struct {
+		conv, in, want string
+	}{
+		{"s2twp", "鼠标和软件", "滑鼠和軟體"},
+		{"s2twp", "我们用鼠标打开文件。", "我們用滑鼠開啟檔案。"},
+		{"S2TWP", "软件", "軟體"}, // names are case-insensitive
+		{"s2t", "鼠标和软件", "鼠標和軟件"},
+		{"t2s", "漢字與繁體中文", "汉字与繁体中文"},
+		{"tw2sp", "滑鼠和軟體", "鼠标和软件"},
+		{"t2s", "ASCII stays, 123", "ASCII stays, 123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.conv+" "+tt.in, func(t *testing.T) {
+			got, err := convertChinese(tt.conv, tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZhConversionRejected(t *testing.T) {
+	if _, err := zhStep("s2x"); err == nil || !strings.Contains(err.Error(), `unknown conversion "s2x"`) {
+		t.Errorf("zhStep: err = %v", err)
+	}
+
+	tests := []struct {
+		name, json, want string
+	}{
+		{"postprocess", `{"profiles": [{"name": "zh", "postprocess": {"convert": "s2x"}}]}`, `unknown conversion "s2x"`},
+		{"hotkey", `{"hotkeys": [{"keys": "Ctrl+Alt+C", "action": "convert", "convert": "zh-tw"}]}`, `unknown conversion "zh-tw"`},
+		{"hotkey without conversion", `{"hotkeys": [{"keys": "Ctrl+Alt+C", "action": "convert"}]}`, "convert needs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadConfig(path, flagDefaults{servers: []string{"http://localhost:8000/upload"}, workers: 1})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// =========================
+// CJK spacing and width
+// =========================
+
+// cjkConfig selects the normalization rules for mixed CJK/Latin text.
+// Rules run in field order.
+type cjkConfig struct {
+	Width       string `json:"width,omitempty"`         // "half": full-width ASCII -> ASCII; "full": ASCII letters/digits -> full-width
+	Punctuation bool   `json:"punctuation,omitempty"`   // ，/, 。/. etc. follow the surrounding script
+	RemoveSpace bool   `json:"remove_spaces,omitempty"` // drop spaces between CJK characters
+	SpaceLatin  bool   `json:"space_latin,omitempty"`   // one space between CJK and Latin letters/digits
+}
+
+func (c *cjkConfig) steps() ([]textStep, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var steps []textStep
+	switch strings.ToLower(c.Width) {
+	case "":
+	case "half":
+		steps = append(steps, toHalfWidth)
+	case "full":
+		steps = append(steps, toFullWidth)
+	default:
+		return nil, fmt.Errorf("width %q: want half or full", c.Width)
+	}
+	if c.Punctuation {
+		steps = append(steps, fixPunctuation)
+	}
+	if c.RemoveSpace {
+		steps = append(steps, removeCJKSpaces)
+	}
+	if c.SpaceLatin {
+		steps = append(steps, spaceCJKLatin)
+	}
+	return steps, nil
+}
+
+// isHan reports CJK letters (ideographs, kana, hangul), as opposed to the
+// punctuation and full-width forms isCJK also covers.
+func isHan(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isLatin(r rune) bool {
+	return r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// toHalfWidth folds full-width ASCII (Ａ, １, ！) and the ideographic space
+// to plain ASCII.
+func toHalfWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E:
+			return r - 0xFEE0
+		case r == 0x3000:
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// toFullWidth widens ASCII letters and digits. Punctuation is left to
+// fixPunctuation, which knows the context.
+func toFullWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isLatin(r) {
+			return r + 0xFEE0
+		}
+		return r
+	}, s)
+}
+
+// Punctuation pairs: Latin form -> CJK form.
+var cjkPunct = map[rune]rune{
+	',': '，', '.': '。', '!': '！', '?': '？', ':': '：', ';': '；', '(': '（', ')': '）',
+}
+
+var latinPunct = func() map[rune]rune {
+	m := make(map[rune]rune, len(cjkPunct))
+	for l, c := range cjkPunct {
+		m[c] = l
+	}
+	m['、'] = ','
+	return m
+}()
+
+// fixPunctuation gives each mark the form of the script it belongs to:
+// the nearest letter before it (numbers are skipped, so "版本1.25。" keeps
+// its full stop), or after it for an opening parenthesis. Marks between
+// digits ("3.14", "12:30"), ellipses ("等等...", "wait。。。") and marks
+// with no letter nearby are left alone.
+func fixPunctuation(s string) string {
+	rs := []rune(s)
+	// letter returns the nearest letter in direction dir, skipping spaces,
+	// digits and the punctuation inside numbers.
+	letter := func(i, dir int) rune {
+		for j := i + dir; j >= 0 && j < len(rs); j += dir {
+			switch r := rs[j]; {
+			case r == ' ' || r == 0x3000 || unicode.IsDigit(r) || r == '.' || r == ',':
+			case unicode.IsLetter(r):
+				return r
+			default:
+				return 0
+			}
+		}
+		return 0
+	}
+
+	var b strings.Builder
+	for i, r := range rs {
+		_, isL := cjkPunct[r]
+		_, isC := latinPunct[r]
+		if !isL && !isC {
+			b.WriteRune(r)
+			continue
+		}
+		var prev, next rune
+		if i > 0 {
+			prev = rs[i-1]
+		}
+		if i+1 < len(rs) {
+			next = rs[i+1]
+		}
+		if unicode.IsDigit(prev) && unicode.IsDigit(next) {
+			b.WriteRune(r)
+			continue
+		}
+		if (r == '.' || r == '。') && (prev == r || next == r) {
+			b.WriteRune(r)
+			continue
+		}
+		ctx := letter(i, -1)
+		if r == '(' || r == '（' {
+			ctx = letter(i, 1)
+		}
+		switch {
+		case isL && isHan(ctx):
+			// "." inside a Latin word ("file.txt") stays.
+			if r == '.' && isLatin(next) {
+				b.WriteRune(r)
+				continue
+			}
+			b.WriteRune(cjkPunct[r])
+		case isC && isLatin(ctx):
+			b.WriteRune(latinPunct[r])
+			if r != '（' && (isLatin(next) || isHan(next)) {
+				b.WriteByte(' ')
+			}
+		case strings.ContainsRune(",!?;", r) && isLatin(ctx) && unicode.IsLetter(next):
+			// Latin punctuation is followed by a space before more text.
+			b.WriteRune(r)
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// removeCJKSpaces drops spaces (ASCII or ideographic) whose neighbours on
+// both sides are CJK characters or CJK punctuation. OCR engines often put
+// them between every glyph.
+func removeCJKSpaces(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != ' ' && rs[i] != 0x3000 {
+			b.WriteRune(rs[i])
+			continue
+		}
+		j := i
+		for j < len(rs) && (rs[j] == ' ' || rs[j] == 0x3000) {
+			j++
+		}
+		if i > 0 && j < len(rs) && isCJK(rs[i-1]) && isCJK(rs[j]) {
+			i = j - 1
+			continue
+		}
+		b.WriteString(string(rs[i:j]))
+		i = j - 1
+	}
+	return b.String()
+}
+
+// spaceCJKLatin puts one space between CJK letters and adjacent Latin
+// letters or digits ("用Go寫" -> "用 Go 寫").
+func spaceCJKLatin(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i, r := range rs {
+		if i > 0 {
+			p := rs[i-1]
+			if (isHan(p) && isLatin(r)) || (isLatin(p) && isHan(r)) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCJKSteps(t *testing.T) {
+	tests := []struct {
+		name string
+		step textStep
+		in   string
+		want string
+	}{
+		{"half width", toHalfWidth, "ＯＣＲ　１２３！（ｏｋ）", "OCR 123!(ok)"},
+		{"half width folds the full-width comma", toHalfWidth, "中文，測試、完成。", "中文,測試、完成。"},
+		{"full width", toFullWidth, "Go 1.25 版", "Ｇｏ １.２５ 版"},
+
+		{"remove spaces", removeCJKSpaces, "這 是 一 個 測 試", "這是一個測試"},
+		{"remove ideographic spaces", removeCJKSpaces, "日本語　の　テキスト", "日本語のテキスト"},
+		{"remove spaces around CJK punctuation", removeCJKSpaces, "你好 ， 世界 。", "你好，世界。"},
+		{"keep Latin spaces", removeCJKSpaces, "hello world 你 好 Go code", "hello world 你好 Go code"},
+
+		{"space latin", spaceCJKLatin, "用Go寫OCR工具2個", "用 Go 寫 OCR 工具 2 個"},
+		{"space latin idempotent", spaceCJKLatin, "用 Go 寫", "用 Go 寫"},
+
+		{"punctuation to CJK", fixPunctuation, "你好,世界.真的?好!", "你好，世界。真的？好！"},
+		{"punctuation to Latin", fixPunctuation, "Hello，world。Really？", "Hello, world. Really?"},
+		{"CJK comma after Latin", fixPunctuation, "apples、pears", "apples, pears"},
+		{"parenthesis follows the next letter", fixPunctuation, "使用(工具)和（tools）", "使用（工具）和(tools)"},
+		{"numbers keep their marks", fixPunctuation, "版本1.25。時間12:30。", "版本1.25。時間12:30。"},
+		{"number before a full stop", fixPunctuation, "版本1.25.", "版本1.25。"},
+		{"file names keep their dot", fixPunctuation, "打開config.json文件", "打開config.json文件"},
+		{"Latin comma gets a space", fixPunctuation, "one,two", "one, two"},
+
+		{"CJK ellipsis", fixPunctuation, "等等...", "等等..."},
+		{"ellipsis then text", fixPunctuation, "等等...好吧.", "等等...好吧。"},
+		{"Latin ellipsis after CJK marks", fixPunctuation, "wait。。。", "wait。。。"},
+		{"unicode ellipsis", fixPunctuation, "等等…好", "等等…好"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.step(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCJKConfigSteps(t *testing.T) {
+	c := &cjkConfig{Width: "half", Punctuation: true, RemoveSpace: true, SpaceLatin: true}
+	steps, err := c.steps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := "我 們 用ＯＣＲ讀 取 , 結 果 很好..."
+	for _, step := range steps {
+		s = step(s)
+	}
+	if want := "我們用 OCR 讀取，結果很好..."; s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+
+	if _, err := (&cjkConfig{Width: "double"}).steps(); err == nil || !strings.Contains(err.Error(), "want half or full") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// =========================
+// Config (profiles + hotkeys)
+// =========================
+
+// Actions a hotkey can trigger.
+const (
+	actionNameOCR    = "ocr"    // select a region and OCR it
+	actionNameScroll = "scroll" // scrolling capture
+	actionNameRepeat = "repeat" // OCR the profile's last region again
+
+	actionNameWatch     = "watch"      // start/stop watching a region for changes
+	actionNameWatchStop = "watch_stop" // stop every running watch and subtitle recording
+	actionNameSubtitle  = "subtitle"   // start/stop recording subtitles from a region
+
+	actionNameConvert = "convert" // convert the clipboard text between zh-Hans and zh-Hant
+)
+
+type config struct {
+	ActiveProfile string           `json:"active_profile"`
+	Profiles      []*profile       `json:"profiles"`
+	Hotkeys       []*hotkeyBinding `json:"hotkeys"`
+	History       *historyConfig   `json:"history,omitempty"`
+	Credentials   string           `json:"credentials,omitempty"` // default %APPDATA%\OcrBoard\credentials.json
+
+	path string
+}
+
+// profile bundles how a capture is processed. Unset fields fall back to the
+// command-line flags.
+type profile struct {
+	Name       string           `json:"name"`
+	Servers    []string         `json:"servers,omitempty"`
+	Backend    *backendConfig   `json:"backend,omitempty"` // default: upload to servers
+	Workers    int              `json:"workers,omitempty"`
+	TileHeight *int             `json:"tile_height,omitempty"`
+	Watch      *watchConfig     `json:"watch,omitempty"`
+	Subtitle   *subtitleConfig  `json:"subtitle,omitempty"`
+	Sinks      []sinkConfig     `json:"sinks,omitempty"`
+	Post       *postConfig      `json:"postprocess,omitempty"`
+	Layout     string           `json:"layout,omitempty"`        // "code", "tsv", "csv", "markdown": rebuild the text from the boxes
+	Order      string           `json:"reading_order,omitempty"` // "auto", "rows", "columns", "vertical"
+	Redact     *redactConfig    `json:"redact,omitempty"`
+	Masks      []maskConfig     `json:"masks,omitempty"` // painted over the capture before upload
+	Extract    *extractConfig   `json:"extract,omitempty"`
+	Barcode    *barcodeConfig   `json:"barcode,omitempty"` // decode QR codes and barcodes locally
+	Translate  *translateConfig `json:"translate,omitempty"`
+
+	pool       *backendPool
+	tile       tileOptions
+	watch      watchConfig
+	subtitle   subtitleConfig
+	sinks      []*outputSink // nil: platform default
+	steps      []textStep
+	redactor   *redactor
+	masks      []*imageMask
+	extract    *extraction
+	barcodes   *barcodeScanner
+	translator *translation
+}
+
+type hotkeyBinding struct {
+	Keys    string `json:"keys"`
+	Action  string `json:"action"`
+	Profile string `json:"profile,omitempty"` // default: active_profile
+	Convert string `json:"convert,omitempty"` // OpenCC conversion for the convert action
+
+	mods, vk uint32
+	profile  *profile
+}
+
+// flagDefaults carries the command-line settings profiles inherit.
+type flagDefaults struct {
+	servers    []string
+	workers    int
+	tileHeight int
+}
+
+func defaultConfig() *config {
+	return &config{
+		ActiveProfile: "default",
+		Profiles:      []*profile{{Name: "default"}},
+		Hotkeys: []*hotkeyBinding{
+			{Keys: "Win+Alt+Shift+T", Action: actionNameOCR},
+			{Keys: "Win+Alt+Shift+S", Action: actionNameScroll},
+			{Keys: "Win+Alt+Shift+R", Action: actionNameRepeat},
+		},
+	}
+}
+
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "OcrBoard")
+}
+
+// loadConfig reads path, or the default config file when path is empty.
+// A missing default file is not an error: the built-in profile is used.
+func loadConfig(path string, def flagDefaults) (*config, error) {
+	cfg := defaultConfig()
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join(configDir(), "config.json")
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		// Decode into a fresh config: decoding over the defaults would merge
+		// the file's profiles and hotkeys into the built-in ones.
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+		file := &config{}
+		if err := json.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+		// Sections the file leaves out keep their defaults; an empty list
+		// ("hotkeys": []) turns them off.
+		if _, ok := keys["profiles"]; !ok {
+			file.Profiles = cfg.Profiles
+		}
+		if _, ok := keys["hotkeys"]; !ok {
+			file.Hotkeys = cfg.Hotkeys
+		}
+		cfg = file
+		cfg.path = path
+	case explicit || !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	if err := cfg.resolve(def); err != nil {
+		if cfg.path != "" {
+			return nil, fmt.Errorf("config %s: %w", cfg.path, err)
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// resolve validates the config, applies flag defaults and links hotkeys to
+// their profiles.
+func (c *config) resolve(def flagDefaults) error {
+	if len(c.Profiles) == 0 {
+		return fmt.Errorf("no profiles")
+	}
+	if h := c.History; h != nil && (h.MaxEntries < 0 || h.MaxAge < 0) {
+		return fmt.Errorf("history: max_entries and max_age must not be negative")
+	}
+	creds := newCredentialStore(c.Credentials)
+	byName := make(map[string]*profile)
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profile without a name")
+		}
+		if byName[p.Name] != nil {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		byName[p.Name] = p
+
+		servers := p.Servers
+		if len(servers) == 0 {
+			servers = def.servers
+		}
+		workers := p.Workers
+		if workers == 0 {
+			workers = def.workers
+		}
+		backends, err := newBackends(p.Backend, p.Name, servers, creds)
+		if err != nil {
+			return fmt.Errorf("profile %q: backend: %w", p.Name, err)
+		}
+		p.pool = newBackendPool(backends, workers)
+
+		p.tile = tileOptions{maxHeight: def.tileHeight, overlap: tileOverlap}
+		if p.TileHeight != nil {
+			p.tile.maxHeight = *p.TileHeight
+		}
+		p.watch = p.Watch.withDefaults()
+		p.subtitle = p.Subtitle.withDefaults()
+		if err := p.subtitle.validate(); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		if len(p.Sinks) > 0 {
+			sinks, err := newSinks(p.Sinks)
+			if err != nil {
+				return fmt.Errorf("profile %q: %w", p.Name, err)
+			}
+			p.sinks = sinks
+		}
+		if err := checkLayout(p.Layout); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		if err := checkOrder(p.Order); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		if p.Layout != layoutText && p.Order != orderBackend {
+			return fmt.Errorf("profile %q: reading_order only applies without layout", p.Name)
+		}
+		steps, err := p.Post.steps()
+		if err != nil {
+			return fmt.Errorf("profile %q: postprocess: %w", p.Name, err)
+		}
+		p.steps = steps
+		if p.redactor, err = p.Redact.compile(p.Name); err != nil {
+			return fmt.Errorf("profile %q: redact: %w", p.Name, err)
+		}
+		if p.masks, err = compileMasks(p.Masks); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		if p.extract, err = p.Extract.compile(p.Name); err != nil {
+			return fmt.Errorf("profile %q: extract: %w", p.Name, err)
+		}
+		if p.barcodes, err = p.Barcode.compile(); err != nil {
+			return fmt.Errorf("profile %q: barcode: %w", p.Name, err)
+		}
+		if p.translator, err = p.Translate.compile(creds); err != nil {
+			return fmt.Errorf("profile %q: translate: %w", p.Name, err)
+		}
+	}
+
+	if c.ActiveProfile == "" {
+		c.ActiveProfile = c.Profiles[0].Name
+	}
+	if byName[c.ActiveProfile] == nil {
+		return fmt.Errorf("active_profile %q not found", c.ActiveProfile)
+	}
+
+	for _, hk := range c.Hotkeys {
+		var err error
+		if hk.mods, hk.vk, err = parseHotkey(hk.Keys); err != nil {
+			return err
+		}
+		switch hk.Action {
+		case actionNameOCR, actionNameScroll, actionNameRepeat, actionNameWatch, actionNameWatchStop, actionNameSubtitle:
+		case actionNameConvert:
+			if hk.Convert == "" {
+				return fmt.Errorf("hotkey %q: convert needs a \"convert\" conversion such as \"s2twp\"", hk.Keys)
+			}
+			if err := checkZhConversion(hk.Convert); err != nil {
+				return fmt.Errorf("hotkey %q: %w", hk.Keys, err)
+			}
+		default:
+			return fmt.Errorf("hotkey %q: unknown action %q", hk.Keys, hk.Action)
+		}
+		name := hk.Profile
+		if name == "" {
+			name = c.ActiveProfile
+		}
+		if hk.profile = byName[name]; hk.profile == nil {
+			return fmt.Errorf("hotkey %q: profile %q not found", hk.Keys, name)
+		}
+	}
+	return nil
+}
+
+// recognize OCRs img with the profile's backends, rebuilds the text in
+// reading order or layout, runs the text post-processing and redacts
+// secrets, so nothing downstream (sinks, history, the translation service)
+// sees them. The redacted text is then translated; with extract set, only
+// the extracted matches are left. Barcode payloads bypass the text
+// rebuilding, post-processing and translation but are still redacted.
+func (p *profile) recognize(ctx context.Context, img *image.RGBA) (*ocrResult, error) {
+	var codes *ocrResult
+	if p.barcodes != nil {
+		start := time.Now()
+		codes = barcodeResult(p.barcodes.decode(img), time.Since(start))
+		p.redactor.apply(codes)
+	}
+	res := codes
+	if !p.barcodes.skipOCR(codes != nil && codes.Text != "") {
+		var err error
+		if res, err = ocrTiled(ctx, p.pool, img, p.tile); err != nil {
+			return nil, err
+		}
+		applyOrder(p.Order, res)
+		applyLayout(p.Layout, res)
+		res.Text = runSteps(p.steps, res.Text)
+		p.redactor.apply(res)
+		p.translator.apply(ctx, res)
+		res = withBarcodes(codes, res)
+	}
+	p.extract.apply(res)
+	return res, nil
+}
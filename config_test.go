@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	def := flagDefaults{servers: []string{"http://localhost:8000/upload"}, workers: 1}
+	tests := []struct {
+		name     string
+		json     string
+		profiles []string
+		hotkeys  int
+	}{
+		{"empty object", `{}`, []string{"default"}, 3},
+		{"profiles only", `{"profiles": [{"name": "docs"}]}`, []string{"docs"}, 3},
+		{"hotkeys off", `{"hotkeys": []}`, []string{"default"}, 0},
+		{"own hotkeys", `{"hotkeys": [{"keys": "Ctrl+Alt+O", "action": "ocr"}]}`, []string{"default"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(path, def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, p := range cfg.Profiles {
+				names = append(names, p.Name)
+			}
+			if len(names) != len(tt.profiles) || names[0] != tt.profiles[0] {
+				t.Errorf("profiles = %v, want %v", names, tt.profiles)
+			}
+			if len(cfg.Hotkeys) != tt.hotkeys {
+				t.Errorf("%d hotkeys, want %d", len(cfg.Hotkeys), tt.hotkeys)
+			}
+			for _, hk := range cfg.Hotkeys {
+				if hk.profile == nil {
+					t.Errorf("hotkey %q not linked to a profile", hk.Keys)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// =========================
+// History export
+// =========================
+
+// historyFilter selects entries for export. Zero fields match everything;
+// until is exclusive.
+type historyFilter struct {
+	since, until time.Time
+	profile      string
+}
+
+func (f historyFilter) match(e historyEntry) bool {
+	return (f.since.IsZero() || !e.Time.Before(f.since)) &&
+		(f.until.IsZero() || e.Time.Before(f.until)) &&
+		(f.profile == "" || e.Profile == f.profile)
+}
+
+// parseDay accepts "2006-01-02" (local midnight) or an RFC 3339 time. For
+// an end date, a plain day means the end of that day.
+func parseDay(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad date %q: want 2006-01-02 or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// exportEntry is a history entry with its thumbnail, as exported.
+type exportEntry struct {
+	historyEntry
+	thumb []byte
+}
+
+// thumbURI is the thumbnail as a data: URI, so exports are single files.
+func (e exportEntry) thumbURI() string {
+	if e.thumb == nil {
+		return ""
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(e.thumb)
+}
+
+// export returns the matching entries oldest first, with thumbnails.
+func (h *history) export(f historyFilter) ([]exportEntry, error) {
+	var out []exportEntry
+	err := h.view(func(tx *bolt.Tx) error {
+		if tx == nil || tx.Bucket(bucketEntries) == nil {
+			return nil
+		}
+		thumbs := tx.Bucket(bucketThumbs)
+		c := tx.Bucket(bucketEntries).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var e historyEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if !f.match(e) {
+				continue
+			}
+			x := exportEntry{historyEntry: e}
+			if thumbs != nil {
+				if t := thumbs.Get(k); t != nil {
+					x.thumb = append([]byte(nil), t...)
+				}
+			}
+			out = append(out, x)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// writeExport writes entries in format. The output depends only on the
+// entries (no export time, stable order), so it can be diffed.
+func writeExport(w io.Writer, format string, entries []exportEntry) error {
+	switch format {
+	case "md", "markdown":
+		return writeExportMarkdown(w, entries)
+	case "csv":
+		return writeExportCSV(w, entries)
+	case "jsonl":
+		return writeExportJSONL(w, entries)
+	case "html":
+		return exportHTML.Execute(w, entries)
+	}
+	return fmt.Errorf("unknown export format %q (want md, csv, jsonl or html)", format)
+}
+
+func exportTime(t time.Time) string { return t.Format(time.RFC3339) }
+
+func latencyMS(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+func writeExportMarkdown(w io.Writer, entries []exportEntry) error {
+	var b strings.Builder
+	b.WriteString("# OcrBoard history\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\n## #%d · %s · %s\n\n", e.ID, exportTime(e.Time), e.Profile)
+		fmt.Fprintf(&b, "Backend: %s (%s ms", e.Backend, latencyMS(e.Latency))
+		if e.Tokens.Total > 0 {
+			fmt.Fprintf(&b, ", %d tokens", e.Tokens.Total)
+		}
+		fmt.Fprintf(&b, ") · Rect: %d,%d %dx%d\n\n", e.Rect.X, e.Rect.Y, e.Rect.W, e.Rect.H)
+		if uri := e.thumbURI(); uri != "" {
+			fmt.Fprintf(&b, "![capture %d](%s)\n\n", e.ID, uri)
+		}
+		// A fence longer than any backtick run in the text.
+		fence := "```"
+		for strings.Contains(e.Text, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&b, "%s\n%s\n%s\n", fence, e.Text, fence)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeExportCSV(w io.Writer, entries []exportEntry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "time", "profile", "backend", "latency_ms", "tokens", "x", "y", "w", "h", "text"})
+	for _, e := range entries {
+		var tokens string
+		if e.Tokens.Total > 0 {
+			tokens = strconv.Itoa(e.Tokens.Total)
+		}
+		_ = cw.Write([]string{
+			strconv.FormatUint(e.ID, 10), exportTime(e.Time), e.Profile, e.Backend, latencyMS(e.Latency), tokens,
+			itoa(e.Rect.X), itoa(e.Rect.Y), itoa(e.Rect.W), itoa(e.Rect.H),
+			e.Text,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func itoa(v int32) string { return strconv.Itoa(int(v)) }
+
+func writeExportJSONL(w io.Writer, entries []exportEntry) error {
+	type record struct {
+		ID        uint64     `json:"id"`
+		Time      string     `json:"time"`
+		Profile   string     `json:"profile"`
+		Backend   string     `json:"backend,omitempty"`
+		LatencyMS int64      `json:"latency_ms"`
+		Tokens    tokenUsage `json:"tokens,omitzero"`
+		Rect      screenRect `json:"rect"`
+		Text      string     `json:"text"`
+		Thumbnail string     `json:"thumbnail,omitempty"` // data: URI
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, e := range entries {
+		err := enc.Encode(record{
+			ID: e.ID, Time: exportTime(e.Time), Profile: e.Profile, Backend: e.Backend,
+			LatencyMS: e.Latency.Milliseconds(), Tokens: e.Tokens, Rect: e.Rect, Text: e.Text, Thumbnail: e.thumbURI(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var exportHTML = template.Must(template.New("gallery").Funcs(template.FuncMap{
+	"time": exportTime,
+	"thumb": func(e exportEntry) template.URL {
+		return template.URL(e.thumbURI())
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>OcrBoard history</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; background: #f6f6f6; }
+.entry { display: flex; gap: 1.5em; background: #fff; padding: 1em; margin-bottom: 1em; border-radius: 6px; }
+.entry img { max-width: 320px; align-self: flex-start; border: 1px solid #ddd; }
+.meta { color: #666; font-size: 0.85em; margin-bottom: 0.5em; }
+pre { white-space: pre-wrap; margin: 0; font-family: ui-monospace, Consolas, monospace; }
+</style>
+</head>
+<body>
+<h1>OcrBoard history</h1>
+{{- range .}}
+<div class="entry" id="e{{.ID}}">
+{{- with thumb .}}
+<img src="{{.}}" alt="">
+{{- end}}
+<div>
+<div class="meta">#{{.ID}} · {{time .Time}} · {{.Profile}} · {{.Backend}}{{with .Tokens.Total}} · {{.}} tokens{{end}} · {{.Rect.X}},{{.Rect.Y}} {{.Rect.W}}×{{.Rect.H}}</div>
+<pre>{{.Text}}</pre>
+</div>
+</div>
+{{- end}}
+</body>
+</html>
+`))
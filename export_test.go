@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// exportSample covers the awkward cases: text with a code fence, commas,
+// quotes, markup and CJK, entries with and without a thumbnail, and a
+// model result with token usage.
+func exportSample() []exportEntry {
+	t0 := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+	return []exportEntry{
+		{historyEntry: historyEntry{
+			ID: 1, Time: t0, Profile: "default", Backend: "http://10.0.1.13:8000/upload",
+			Latency: 420 * time.Millisecond, Rect: screenRect{X: 10, Y: 20, W: 640, H: 120},
+			Text: "Invoice 2024-017, total \"1,200.00\"\n```go\nfmt.Println(\"<b>\")\n```",
+		}, thumb: []byte("\x89PNG fake")},
+		{historyEntry: historyEntry{
+			ID: 2, Time: t0.Add(90 * time.Minute), Profile: "docs", Backend: "tesseract",
+			Latency: 1250 * time.Millisecond, Rect: screenRect{X: -1920, Y: 0, W: 800, H: 600},
+			Text: "光學字元辨識 & <OCR>",
+		}},
+		{historyEntry: historyEntry{
+			ID: 3, Time: t0.Add(3 * time.Hour), Profile: "handwriting", Backend: "qwen2.5-vl @ http://localhost:8080/v1/chat/completions",
+			Latency: 3200 * time.Millisecond, Tokens: tokenUsage{Prompt: 812, Completion: 41, Total: 853},
+			Rect: screenRect{X: 0, Y: 0, W: 400, H: 300}, Text: "Meeting notes",
+		}},
+	}
+}
+
+func TestWriteExportGolden(t *testing.T) {
+	for _, format := range []string{"md", "csv", "jsonl", "html"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeExport(&buf, format, exportSample()); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "export."+format)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output differs from %s (run with -update to accept):\n%s", golden, buf.String())
+			}
+		})
+	}
+	if err := writeExport(&bytes.Buffer{}, "pdf", nil); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	day := func(s string, end bool) time.Time {
+		v, err := parseDay(s, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	e := historyEntry{Time: time.Date(2024, 3, 9, 23, 59, 0, 0, time.Local), Profile: "docs"}
+	tests := []struct {
+		name string
+		f    historyFilter
+		want bool
+	}{
+		{"everything", historyFilter{}, true},
+		{"same day", historyFilter{since: day("2024-03-09", false), until: day("2024-03-09", true)}, true},
+		{"before", historyFilter{until: day("2024-03-08", true)}, false},
+		{"after", historyFilter{since: day("2024-03-10", false)}, false},
+		{"profile", historyFilter{profile: "docs"}, true},
+		{"other profile", historyFilter{profile: "default"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.f.match(e); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := parseDay("9/3/2024", false); err == nil {
+		t.Error("bad date accepted")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// =========================
+// Extraction
+// =========================
+
+// extractConfig is the per-profile "extract" section. When set, the
+// result text is replaced by the matches of the built-in extractors and
+// rules, in text order, joined with Separator (default newline).
+type extractConfig struct {
+	Extractors []string      `json:"extractors,omitempty"` // built-in names, see extractors
+	Rules      []extractRule `json:"rules,omitempty"`
+	Separator  string        `json:"separator,omitempty"`
+	Unique     bool          `json:"unique,omitempty"` // drop repeated matches
+}
+
+type extractRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`         // Go regexp
+	Group   int    `json:"group,omitempty"` // submatch to copy, default the whole match
+}
+
+type extractor struct {
+	name  string
+	re    *regexp.Regexp
+	group int
+	check func(string) bool   // extra validation of a match, may be nil
+	clean func(string) string // trims what the pattern over-matches, may be nil
+	alone bool                // reject matches that are part of a word, version or address
+}
+
+// Building blocks of the number-like extractors. Thousands separators are
+// "," "." "'" or a no-break space; a plain space would join separate numbers.
+const (
+	reNumber   = `\d{1,3}(?:[,.'\x{00A0}\x{202F}]\d{3})+(?:[.,]\d+)?|\d+(?:[.,]\d+)?`
+	reCurrency = `[$€£¥₹₩₽₺₴₫฿元円]|US\$|HK\$|NT\$|A\$|C\$|R\$`
+	reCode     = `\b(?:USD|EUR|GBP|JPY|CNY|RMB|CHF|CAD|AUD|HKD|TWD|KRW|INR|RUB|BRL|SEK|NOK|DKK|PLN|CZK|SGD|NZD|MXN|ZAR)\b`
+	reMonth    = `(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Sept|Oct|Nov|Dec)[a-z]*\.?`
+	// reURLChar is what a URL may contain: not white space, quotes or
+	// angle brackets, and not the full-width punctuation of CJK text that
+	// follows a URL without a space.
+	reURLChar = `[^\s<>"'` + "`" + `。，、；：！？「」『』（）【】《》〈〉]`
+	reUnit    = `%|‰|°[CF]?|(?:[kMGT]i?B|B|bytes?|[kmµn]?m|mi|ft|[km]?g|lbs?|oz|[mµ]?[lL]|[mµn]?s|min|h|[kMG]?Hz|k?Wh?|[mk]?V|m?A|px|pt|em)\b`
+)
+
+// extractors are the built-in extractors by name.
+var extractors = map[string]extractor{
+	"url":   {re: regexp.MustCompile(`\b(?:https?|ftp)://` + reURLChar + `+|\bwww\.[A-Za-z0-9-]+\.` + reURLChar + `+`), clean: trimURL},
+	"email": {re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	"ipv4":  {re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)},
+	"ipv6":  {re: regexp.MustCompile(`(?i)[0-9a-f:][0-9a-f:.]*:[0-9a-f:.]*`), clean: func(s string) string { return strings.TrimRight(s, ".") }, check: ipv6Valid},
+	"uuid":  {re: regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)},
+	"date": {re: regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?)?\b` +
+		`|\b\d{4}/\d{1,2}/\d{1,2}\b` +
+		`|\b\d{1,2}[./-]\d{1,2}[./-](?:\d{4}|\d{2})\b` +
+		`|\b\d{1,2}\.? ` + reMonth + `,? \d{4}\b` +
+		`|\b` + reMonth + ` \d{1,2}(?:st|nd|rd|th)?,? \d{4}\b` +
+		`|\d{4}年\d{1,2}月\d{1,2}日`), check: dateValid},
+	"amount": {re: regexp.MustCompile(`[-−]?(?:` + reCurrency + `)\s?(?:` + reNumber + `)` +
+		`|[-−]?(?:` + reNumber + `)\s?(?:` + reCurrency + `|` + reCode + `)` +
+		`|` + reCode + `\s?[-−]?(?:` + reNumber + `)`)},
+	"quantity": {re: regexp.MustCompile(`[-−+]?(?:` + reNumber + `)\s?(?:` + reUnit + `)`), alone: true},
+	"number":   {re: regexp.MustCompile(`[-−+]?(?:` + reNumber + `)`), alone: true},
+}
+
+func extractorNames() []string {
+	names := make([]string, 0, len(extractors))
+	for n := range extractors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extraction applies the compiled extractors of one profile.
+type extraction struct {
+	profile    string
+	extractors []extractor
+	separator  string
+	unique     bool
+}
+
+func (c *extractConfig) compile(profile string) (*extraction, error) {
+	if c == nil {
+		return nil, nil
+	}
+	x := &extraction{profile: profile, separator: c.Separator, unique: c.Unique}
+	if x.separator == "" {
+		x.separator = "\n"
+	}
+	for _, name := range c.Extractors {
+		e, ok := extractors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extractor %q (want one of %s)", name, strings.Join(extractorNames(), ", "))
+		}
+		e.name = name
+		x.extractors = append(x.extractors, e)
+	}
+	for _, rule := range c.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %q: missing name", rule.Pattern)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		if rule.Group < 0 || rule.Group > re.NumSubexp() {
+			return nil, fmt.Errorf("rule %q: pattern has no group %d", rule.Name, rule.Group)
+		}
+		x.extractors = append(x.extractors, extractor{name: rule.Name, re: re, group: rule.Group})
+	}
+	if len(x.extractors) == 0 {
+		return nil, fmt.Errorf("no extractors or rules")
+	}
+	return x, nil
+}
+
+type extractMatch struct {
+	start, end int
+	value      string
+}
+
+// matches returns the matches of every extractor in text order. Where
+// matches overlap, the one starting first wins, then the longest: a date
+// is not also copied as three numbers.
+func (x *extraction) matches(s string) []string {
+	var all []extractMatch
+	for _, e := range x.extractors {
+		for _, m := range e.re.FindAllStringSubmatchIndex(s, -1) {
+			start, end := m[2*e.group], m[2*e.group+1]
+			if start < 0 {
+				continue // optional group did not take part
+			}
+			v := s[start:end]
+			if e.clean != nil {
+				v = e.clean(v)
+				end = start + len(v)
+			}
+			if v == "" || e.check != nil && !e.check(v) || e.alone && !standsAlone(s, start, end) {
+				continue
+			}
+			all = append(all, extractMatch{start, end, v})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end > all[j].end
+	})
+
+	var out []string
+	seen := make(map[string]bool)
+	end := 0
+	for _, m := range all {
+		if m.start < end {
+			continue
+		}
+		end = m.end
+		if x.unique {
+			if seen[m.value] {
+				continue
+			}
+			seen[m.value] = true
+		}
+		out = append(out, m.value)
+	}
+	return out
+}
+
+// apply replaces the text of res with the joined matches. An empty result
+// means nothing matched.
+func (x *extraction) apply(res *ocrResult) {
+	if x == nil {
+		return
+	}
+	found := x.matches(res.Text)
+	res.Text = strings.Join(found, x.separator)
+	fmt.Printf("[OCR] Extract (%s): %d match(es)\n", x.profile, len(found))
+}
+
+// standsAlone reports whether s[start:end] is not glued to the text
+// around it: "A-1234", "v1.2" and the parts of 192.168.1.10 or 12:30 are
+// not numbers of their own.
+func standsAlone(s string, start, end int) bool {
+	word := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	if before, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 {
+		if word(before) {
+			return false
+		}
+		first, _ := utf8.DecodeRuneInString(s[start:])
+		if unicode.IsDigit(first) && strings.ContainsRune(".:/-", before) {
+			return false
+		}
+	}
+	if end < len(s) {
+		after, n := utf8.DecodeRuneInString(s[end:])
+		if word(after) {
+			return false
+		}
+		next, _ := utf8.DecodeRuneInString(s[end+n:])
+		if strings.ContainsRune(".,:/-", after) && word(next) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimURL drops trailing punctuation that ends the sentence rather than
+// the URL, and closing brackets without an opening one in the URL.
+func trimURL(s string) string {
+	for s != "" {
+		last := s[len(s)-1]
+		switch last {
+		case '.', ',', ';', ':', '!', '?':
+		case ')', ']', '}':
+			open := map[byte]byte{')': '(', ']': '[', '}': '{'}[last]
+			if strings.Count(s, string(open)) >= strings.Count(s, string(last)) {
+				return s
+			}
+		default:
+			return s
+		}
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// ipv6Valid keeps candidates that parse as IPv6 addresses; the pattern
+// also catches times like 12:30:45.
+func ipv6Valid(s string) bool {
+	if strings.Count(s, ":") < 2 {
+		return false
+	}
+	ip := net.ParseIP(s)
+	return ip != nil && strings.ContainsAny(s, "0123456789abcdefABCDEF")
+}
+
+var reDigits = regexp.MustCompile(`\d+`)
+
+// dateValid rejects dates that are not on the calendar, such as 2023-02-30
+// or 31 Apr 2024. Day and month are tried in either order when the year
+// comes last (13/12/2024, 12/13/2024); two-digit years are 20xx.
+func dateValid(s string) bool {
+	nums := reDigits.FindAllString(s, -1)
+	num := func(i int) int { v, _ := strconv.Atoi(nums[i]); return v }
+	if m := monthName(s); m > 0 { // 5 Jan 2024, January 5th, 2024
+		return len(nums) == 2 && validDay(num(1), m, num(0))
+	}
+	if len(nums) < 3 {
+		return false
+	}
+	if len(nums[0]) == 4 { // 2024-05-06, 2024/5/6, 2024年5月6日, time parts follow
+		return validDay(num(0), num(1), num(2))
+	}
+	y := num(2)
+	if len(nums[2]) == 2 {
+		y += 2000
+	}
+	return validDay(y, num(1), num(0)) || validDay(y, num(0), num(1))
+}
+
+// monthName returns the month (1-12) named by the first word of letters
+// in s, or 0.
+func monthName(s string) int {
+	i := strings.IndexFunc(s, unicode.IsLetter)
+	if i < 0 {
+		return 0
+	}
+	word := s[i:]
+	if j := strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }); j >= 0 {
+		word = word[:j]
+	}
+	if len(word) < 3 {
+		return 0
+	}
+	for m := time.January; m <= time.December; m++ {
+		if strings.EqualFold(word[:3], m.String()[:3]) {
+			return int(m)
+		}
+	}
+	return 0
+}
+
+// validDay reports whether day d of month m exists in year y.
+func validDay(y, m, d int) bool {
+	if m < 1 || m > 12 || d < 1 {
+		return false
+	}
+	return d <= time.Date(y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	tests := []struct {
+		extractor string
+		in        string
+		want      []string
+	}{
+		{"date", "due 2024-05-06, sent 2024-05-06T07:08:09Z", []string{"2024-05-06", "2024-05-06T07:08:09Z"}},
+		{"date", "2024/5/6 and 2024年5月6日", []string{"2024/5/6", "2024年5月6日"}},
+		{"date", "13/12/2024 12/13/2024 06.05.24", []string{"13/12/2024", "12/13/2024", "06.05.24"}},
+		{"date", "5 Jan 2024, January 5th, 2024, 6. Mai 2024", []string{"5 Jan 2024", "January 5th, 2024"}},
+		{"date", "2024-02-29 2023-02-29 2023-02-30 2023-13-01 2023-00-10", []string{"2024-02-29"}},
+		{"date", "13/13/2024 31/04/2024 0/5/2024 31 Apr 2024 Feb 30, 2023", nil},
+
+		{"amount", "Total $1,234.56 or 1.234,56 € (USD 12)", []string{"$1,234.56", "1.234,56 €", "USD 12"}},
+		{"amount", "NT$ 500, 300元, -€20, 42 EUR", []string{"NT$ 500", "300元", "-€20", "42 EUR"}},
+		{"amount", "42 apples for 3.50", nil},
+
+		{"quantity", "5 kg, 1.5 GB, 25°C and 60 Hz", []string{"5 kg", "1.5 GB", "25°C", "60 Hz"}},
+		{"quantity", "90% done in 3 min", []string{"90%", "3 min"}},
+		{"quantity", "A-12 kg, v1.2 GB, 10ms", []string{"10ms"}},
+
+		{"ipv6", "fe80::1 and 2001:db8:0:0:1:0:0:1.", []string{"fe80::1", "2001:db8:0:0:1:0:0:1"}},
+		{"ipv6", "::ffff:192.0.2.1 at 12:30:45", []string{"::ffff:192.0.2.1"}},
+		{"ipv6", "see 1:2 or a::b::c", nil},
+
+		{"url", "see https://example.com/a.", []string{"https://example.com/a"}},
+		{"url", "(see https://example.com/docs).", []string{"https://example.com/docs"}},
+		{"url", "https://en.wikipedia.org/wiki/Go_(language)), ok", []string{"https://en.wikipedia.org/wiki/Go_(language)"}},
+		{"url", "請看https://example.com/a。謝謝", []string{"https://example.com/a"}},
+		{"url", "網址：www.example.com，（https://example.com/x）", []string{"www.example.com", "https://example.com/x"}},
+		{"url", `<a href="http://example.com?q=1&r=2">`, []string{"http://example.com?q=1&r=2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.extractor+" "+tt.in, func(t *testing.T) {
+			x, err := (&extractConfig{Extractors: []string{tt.extractor}}).compile("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := x.matches(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStandsAlone(t *testing.T) {
+	tests := []struct {
+		s, match string
+		want     bool
+	}{
+		{"costs 42 now", "42", true},
+		{"42", "42", true},
+		{"(42)", "42", true},
+		{"42.", "42", true},    // end of a sentence
+		{"42, 43", "42", true}, // list
+		{"A-1234", "1234", false},
+		{"v1.2", "1.2", false},
+		{"192.168.1.10", "168", false},
+		{"12:30", "30", false},
+		{"12:30", "12", false},
+		{"4.2GHz", "4.2", false},
+		{"型號42號", "42", false}, // CJK letters count as word characters
+		{"price:42", "42", false},
+	}
+	for _, tt := range tests {
+		start := -1
+		for i := range len(tt.s) - len(tt.match) + 1 {
+			if tt.s[i:i+len(tt.match)] == tt.match {
+				start = i
+				break
+			}
+		}
+		if got := standsAlone(tt.s, start, start+len(tt.match)); got != tt.want {
+			t.Errorf("%q in %q: got %v, want %v", tt.match, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestExtractOverlapsAndOptions(t *testing.T) {
+	x, err := (&extractConfig{
+		Extractors: []string{"date", "number"},
+		Rules:      []extractRule{{Name: "order", Pattern: `Order #(\d+)`, Group: 1}},
+		Separator:  "|",
+		Unique:     true,
+	}).compile("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &ocrResult{Text: "Order #77 on 2024-05-06: 3 items, 3 boxes"}
+	x.apply(res)
+	if want := "77|2024-05-06|3"; res.Text != want {
+		t.Errorf("got %q, want %q", res.Text, want)
+	}
+
+	for _, c := range []extractConfig{
+		{},
+		{Extractors: []string{"phone"}},
+		{Rules: []extractRule{{Pattern: `x`}}},
+		{Rules: []extractRule{{Name: "bad", Pattern: `(`}}},
+		{Rules: []extractRule{{Name: "group", Pattern: `(a)`, Group: 2}}},
+	} {
+		if _, err := c.compile("test"); err == nil {
+			t.Errorf("%+v: no error", c)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"image"
+	"sync"
+)
+
+// =========================
+// Frame (shared BGRA capture buffer)
+// =========================
+
+// frame is a captured rectangle of the virtual screen. Pix is the top-down
+// 32bpp BGRA layout GetDIBits produces and StretchDIBits consumes, so the
+// same buffer backs both the selection overlay and the crop sent for OCR.
+type frame struct {
+	X, Y int32 // virtual-screen origin
+	W, H int32
+	Pix  []byte
+}
+
+var framePool sync.Pool // *[]byte
+
+func getFrameBuf(n int) []byte {
+	if p, ok := framePool.Get().(*[]byte); ok && cap(*p) >= n {
+		return (*p)[:n]
+	}
+	return make([]byte, n)
+}
+
+func newFrame(x, y, w, h int32) *frame {
+	return &frame{X: x, Y: y, W: w, H: h, Pix: getFrameBuf(int(w) * int(h) * 4)}
+}
+
+// release hands the pixel buffer back to the pool. The frame must not be
+// used afterwards.
+func (f *frame) release() {
+	if f == nil || f.Pix == nil {
+		return
+	}
+	buf := f.Pix[:0]
+	f.Pix = nil
+	framePool.Put(&buf)
+}
+
+func (f *frame) stride() int {
+	return int(f.W) * 4
+}
+
+// bgraToRGBA swizzles one row of pixels. Screen captures carry no useful
+// alpha (GDI usually leaves it 0), so the output is always opaque.
+func bgraToRGBA(dst, src []byte) {
+	n := len(src) &^ 3
+	if len(dst) < n {
+		n = len(dst) &^ 3
+	}
+	for i := 0; i < n; i += 4 {
+		s := src[i : i+4 : i+4]
+		d := dst[i : i+4 : i+4]
+		d[0] = s[2]
+		d[1] = s[1]
+		d[2] = s[0]
+		d[3] = 0xFF
+	}
+}
+
+// rgbaToBGRA is the inverse of bgraToRGBA, used to build frames from
+// decoded or synthetic images.
+func rgbaToBGRA(dst, src []byte) {
+	n := len(src) &^ 3
+	if len(dst) < n {
+		n = len(dst) &^ 3
+	}
+	for i := 0; i < n; i += 4 {
+		s := src[i : i+4 : i+4]
+		d := dst[i : i+4 : i+4]
+		d[0] = s[2]
+		d[1] = s[1]
+		d[2] = s[0]
+		d[3] = s[3]
+	}
+}
+
+// frameFromRGBA copies img into a new frame placed at (x, y).
+func frameFromRGBA(img *image.RGBA, x, y int32) *frame {
+	b := img.Bounds()
+	f := newFrame(x, y, int32(b.Dx()), int32(b.Dy()))
+	rowBytes := f.stride()
+	for row := 0; row < int(f.H); row++ {
+		src := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+row):]
+		rgbaToBGRA(f.Pix[row*rowBytes:(row+1)*rowBytes], src[:rowBytes])
+	}
+	return f
+}
+
+// cropRGBA converts only the selected rectangle (virtual-screen coordinates)
+// to RGBA. The rectangle is clamped to the frame; nil means nothing is left.
+func (f *frame) cropRGBA(l, t, r, b int32) *image.RGBA {
+	lx := int(l - f.X)
+	ty := int(t - f.Y)
+	rx := int(r - f.X)
+	by := int(b - f.Y)
+
+	if lx < 0 {
+		lx = 0
+	}
+	if ty < 0 {
+		ty = 0
+	}
+	if rx > int(f.W) {
+		rx = int(f.W)
+	}
+	if by > int(f.H) {
+		by = int(f.H)
+	}
+	if rx <= lx || by <= ty {
+		return nil
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rx-lx, by-ty))
+	rowBytes := (rx - lx) * 4
+	stride := f.stride()
+	for y := ty; y < by; y++ {
+		srcOff := y*stride + lx*4
+		dstOff := (y - ty) * dst.Stride
+		bgraToRGBA(dst.Pix[dstOff:dstOff+rowBytes], f.Pix[srcOff:srcOff+rowBytes])
+	}
+	return dst
+}
+
+// rgba converts the whole frame.
+func (f *frame) rgba() *image.RGBA {
+	return f.cropRGBA(f.X, f.Y, f.X+f.W, f.Y+f.H)
+}
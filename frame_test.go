@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func testPattern(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 0xFF})
+		}
+	}
+	return img
+}
+
+func TestFrameCropRGBA(t *testing.T) {
+	src := testPattern(64, 48)
+	f := frameFromRGBA(src, 100, 200)
+	defer f.release()
+
+	tests := []struct {
+		name       string
+		l, t, r, b int32
+		want       image.Rectangle // in src coordinates; empty means nil
+	}{
+		{"whole", 100, 200, 164, 248, image.Rect(0, 0, 64, 48)},
+		{"inner", 110, 205, 130, 215, image.Rect(10, 5, 30, 15)},
+		{"clamped", 90, 190, 120, 300, image.Rect(0, 0, 20, 48)},
+		{"outside", 0, 0, 50, 50, image.Rectangle{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.cropRGBA(tt.l, tt.t, tt.r, tt.b)
+			if tt.want.Empty() {
+				if got != nil {
+					t.Fatalf("got %v, want nil", got.Bounds())
+				}
+				return
+			}
+			if got == nil || got.Bounds().Size() != tt.want.Size() {
+				t.Fatalf("got %v, want size %v", got, tt.want.Size())
+			}
+			want := src.SubImage(tt.want).(*image.RGBA)
+			for y := 0; y < tt.want.Dy(); y++ {
+				g := got.Pix[got.PixOffset(0, y):][:tt.want.Dx()*4]
+				w := want.Pix[want.PixOffset(tt.want.Min.X, tt.want.Min.Y+y):][:tt.want.Dx()*4]
+				if !bytes.Equal(g, w) {
+					t.Fatalf("row %d differs", y)
+				}
+			}
+		})
+	}
+}
+
+func TestFramePoolReuse(t *testing.T) {
+	f := newFrame(0, 0, 32, 32)
+	f.release()
+	if f.Pix != nil {
+		t.Error("release kept the buffer")
+	}
+	f.release() // second release is a no-op
+
+	g := newFrame(0, 0, 16, 16)
+	defer g.release()
+	if len(g.Pix) != 16*16*4 {
+		t.Errorf("len = %d, want %d", len(g.Pix), 16*16*4)
+	}
+}
+
+func BenchmarkFrame(b *testing.B) {
+	sizes := []struct {
+		name string
+		w, h int32
+	}{
+		{"1080p", 1920, 1080},
+		{"4k", 3840, 2160},
+	}
+	for _, s := range sizes {
+		n := int(s.w) * int(s.h) * 4
+		b.Run(s.name+"/make", func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for b.Loop() {
+				f := &frame{W: s.w, H: s.h, Pix: make([]byte, n)}
+				_ = f
+			}
+		})
+		b.Run(s.name+"/pool", func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for b.Loop() {
+				newFrame(0, 0, s.w, s.h).release()
+			}
+		})
+		b.Run(s.name+"/crop", func(b *testing.B) {
+			f := newFrame(0, 0, s.w, s.h)
+			defer f.release()
+			b.SetBytes(int64(n / 4))
+			for b.Loop() {
+				f.cropRGBA(s.w/4, s.h/4, s.w*3/4, s.h*3/4)
+			}
+		})
+	}
+}
@@ -3,3 +3,16 @@ module OcrBoard
 go 1.25.0
 
 require golang.org/x/sys v0.41.0
+
+require (
+	github.com/longbridgeapp/opencc v0.3.13
+	github.com/makiuchi-d/gozxing v0.1.1
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/text v0.40.0
+)
+
+require (
+	github.com/liuzl/cedar-go v0.0.0-20170805034717-80a9c64b256d // indirect
+	github.com/liuzl/da v0.0.0-20180704015230-14771aad5b1d // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
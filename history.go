@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// =========================
+// History (bbolt)
+// =========================
+
+// historyConfig is the top-level "history" section. History is on by
+// default; retention limits are off unless set.
+type historyConfig struct {
+	Disabled   bool     `json:"disabled,omitempty"`
+	Path       string   `json:"path,omitempty"`        // default: %APPDATA%\OcrBoard\history.db
+	MaxEntries int      `json:"max_entries,omitempty"` // keep the newest N entries
+	MaxAge     duration `json:"max_age,omitempty"`     // drop entries older than this, e.g. "720h"
+	Thumbnails bool     `json:"thumbnails,omitempty"`  // store a small PNG of each capture
+}
+
+// historyEntry is one stored OCR result.
+type historyEntry struct {
+	ID      uint64        `json:"id"`
+	Time    time.Time     `json:"time"`
+	Profile string        `json:"profile"`
+	Backend string        `json:"backend,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Tokens  tokenUsage    `json:"tokens,omitzero"`
+	Rect    screenRect    `json:"rect"`
+	Text    string        `json:"text"`
+	Thumb   bool          `json:"thumb,omitempty"`
+}
+
+var (
+	bucketEntries = []byte("entries") // id -> historyEntry JSON
+	bucketIndex   = []byte("index")   // token 0x00 id -> nil
+	bucketThumbs  = []byte("thumbs")  // id -> PNG
+)
+
+const thumbSize = 320
+
+// history is the on-disk result store. The database is opened per call,
+// so the history command can read it while OcrBoard is running.
+type history struct {
+	path string
+	cfg  historyConfig
+}
+
+// newHistory returns nil when history is disabled.
+func newHistory(c *historyConfig) *history {
+	cfg := historyConfig{}
+	if c != nil {
+		cfg = *c
+	}
+	if cfg.Disabled {
+		return nil
+	}
+	path := cfg.Path
+	if path == "" {
+		path = filepath.Join(configDir(), "history.db")
+	}
+	return &history{path: path, cfg: cfg}
+}
+
+func (h *history) update(fn func(tx *bolt.Tx) error) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+	db, err := bolt.Open(h.path, 0o600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return fmt.Errorf("history %s: %w", h.path, err)
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+// view runs fn read-only. A missing database reads as empty.
+func (h *history) view(fn func(tx *bolt.Tx) error) error {
+	if _, err := os.Stat(h.path); errors.Is(err, fs.ErrNotExist) {
+		return fn(nil)
+	}
+	db, err := bolt.Open(h.path, 0o600, &bolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("history %s: %w", h.path, err)
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+func idKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+func indexKey(token string, id uint64) []byte {
+	return append(append([]byte(token), 0), idKey(id)...)
+}
+
+// add stores out (and a thumbnail of img when enabled), then applies the
+// retention limits. It returns the new entry's id. Redacted results get no
+// thumbnail: the capture would still show what the text rules removed.
+func (h *history) add(out *ocrOutput, img image.Image) (uint64, error) {
+	var thumb []byte
+	if h.cfg.Thumbnails && img != nil && !out.Redacted {
+		var err error
+		if thumb, err = encodePNG(thumbnail(img, thumbSize)); err != nil {
+			return 0, err
+		}
+	}
+
+	var id uint64
+	err := h.update(func(tx *bolt.Tx) error {
+		entries, err := tx.CreateBucketIfNotExists(bucketEntries)
+		if err != nil {
+			return err
+		}
+		index, err := tx.CreateBucketIfNotExists(bucketIndex)
+		if err != nil {
+			return err
+		}
+		thumbs, err := tx.CreateBucketIfNotExists(bucketThumbs)
+		if err != nil {
+			return err
+		}
+		if id, err = entries.NextSequence(); err != nil {
+			return err
+		}
+
+		e := historyEntry{
+			ID: id, Time: out.Time, Profile: out.Profile, Backend: out.Backend,
+			Latency: out.Latency, Tokens: out.Tokens, Rect: out.Rect, Text: out.Text, Thumb: thumb != nil,
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := entries.Put(idKey(id), data); err != nil {
+			return err
+		}
+		for _, tok := range tokenize(e.Text) {
+			if err := index.Put(indexKey(tok, id), nil); err != nil {
+				return err
+			}
+		}
+		if thumb != nil {
+			if err := thumbs.Put(idKey(id), thumb); err != nil {
+				return err
+			}
+		}
+		return h.prune(tx, out.Time)
+	})
+	return id, err
+}
+
+// prune drops entries beyond max_entries and older than max_age.
+func (h *history) prune(tx *bolt.Tx, now time.Time) error {
+	entries := tx.Bucket(bucketEntries)
+	if entries == nil {
+		return nil
+	}
+	excess := 0
+	if h.cfg.MaxEntries > 0 {
+		excess = countKeys(entries) - h.cfg.MaxEntries
+	}
+	cutoff := time.Time{}
+	if h.cfg.MaxAge > 0 {
+		cutoff = now.Add(-time.Duration(h.cfg.MaxAge))
+	}
+
+	// Oldest first; ids grow with time.
+	var drop []historyEntry
+	c := entries.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var e historyEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		if len(drop) < excess || e.Time.Before(cutoff) {
+			drop = append(drop, e)
+			continue
+		}
+		break
+	}
+	for _, e := range drop {
+		if err := deleteEntry(tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record adds out to the history, logging instead of failing: a locked
+// or broken database must not get in the way of the result itself.
+func (h *history) record(out *ocrOutput, img image.Image) {
+	if h == nil {
+		return
+	}
+	if _, err := h.add(out, img); err != nil {
+		fmt.Printf("[OCR] History: %v\n", err)
+	}
+}
+
+func countKeys(b *bolt.Bucket) int {
+	n := 0
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+func deleteEntry(tx *bolt.Tx, e historyEntry) error {
+	if err := tx.Bucket(bucketEntries).Delete(idKey(e.ID)); err != nil {
+		return err
+	}
+	if index := tx.Bucket(bucketIndex); index != nil {
+		for _, tok := range tokenize(e.Text) {
+			if err := index.Delete(indexKey(tok, e.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	if thumbs := tx.Bucket(bucketThumbs); thumbs != nil {
+		return thumbs.Delete(idKey(e.ID))
+	}
+	return nil
+}
+
+func getEntry(tx *bolt.Tx, id uint64) (historyEntry, bool, error) {
+	var e historyEntry
+	if tx == nil || tx.Bucket(bucketEntries) == nil {
+		return e, false, nil
+	}
+	v := tx.Bucket(bucketEntries).Get(idKey(id))
+	if v == nil {
+		return e, false, nil
+	}
+	err := json.Unmarshal(v, &e)
+	return e, true, err
+}
+
+// list returns up to limit entries, newest first.
+func (h *history) list(limit int) ([]historyEntry, error) {
+	var out []historyEntry
+	err := h.view(func(tx *bolt.Tx) error {
+		if tx == nil || tx.Bucket(bucketEntries) == nil {
+			return nil
+		}
+		c := tx.Bucket(bucketEntries).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(out) < limit); k, v = c.Prev() {
+			var e historyEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// search returns entries containing every token of query, newest first.
+// A token also matches longer index tokens it is a prefix of, so "hist"
+// finds "history".
+func (h *history) search(query string, limit int) ([]historyEntry, error) {
+	tokens := splitTokens(query, false)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	var out []historyEntry
+	err := h.view(func(tx *bolt.Tx) error {
+		if tx == nil || tx.Bucket(bucketIndex) == nil {
+			return nil
+		}
+		c := tx.Bucket(bucketIndex).Cursor()
+		var ids map[uint64]bool
+		for _, tok := range tokens {
+			found := make(map[uint64]bool)
+			for k, _ := c.Seek([]byte(tok)); k != nil && bytes.HasPrefix(k, []byte(tok)); k, _ = c.Next() {
+				if len(k) < 9 {
+					continue
+				}
+				id := binary.BigEndian.Uint64(k[len(k)-8:])
+				if ids == nil || ids[id] {
+					found[id] = true
+				}
+			}
+			ids = found
+			if len(ids) == 0 {
+				return nil
+			}
+		}
+
+		sorted := make([]uint64, 0, len(ids))
+		for id := range ids {
+			sorted = append(sorted, id)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+		for _, id := range sorted {
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+			e, ok, err := getEntry(tx, id)
+			if err != nil {
+				return err
+			}
+			if ok {
+				out = append(out, e)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// get returns one entry and its thumbnail (nil when none was stored).
+func (h *history) get(id uint64) (historyEntry, []byte, error) {
+	var e historyEntry
+	var thumb []byte
+	err := h.view(func(tx *bolt.Tx) error {
+		var ok bool
+		var err error
+		if e, ok, err = getEntry(tx, id); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("history entry %d not found", id)
+		}
+		if b := tx.Bucket(bucketThumbs); b != nil {
+			if v := b.Get(idKey(id)); v != nil {
+				thumb = append([]byte(nil), v...)
+			}
+		}
+		return nil
+	})
+	return e, thumb, err
+}
+
+// remove deletes the given entries; with no ids it deletes everything.
+// It returns how many entries were removed.
+func (h *history) remove(ids []uint64) (int, error) {
+	n := 0
+	err := h.update(func(tx *bolt.Tx) error {
+		if ids == nil {
+			if b := tx.Bucket(bucketEntries); b != nil {
+				n = countKeys(b)
+			}
+			for _, name := range [][]byte{bucketEntries, bucketIndex, bucketThumbs} {
+				if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, id := range ids {
+			e, ok, err := getEntry(tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("history entry %d not found", id)
+			}
+			if err := deleteEntry(tx, e); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// =========================
+// Tokenizer
+// =========================
+
+// tokenize splits text into index tokens: lower-cased words and numbers,
+// and for runs of CJK characters (which have no spaces) every character
+// plus the overlapping bigrams. Tokens are unique and sorted.
+func tokenize(s string) []string {
+	seen := make(map[string]bool)
+	for _, tok := range splitTokens(s, true) {
+		seen[tok] = true
+	}
+	out := make([]string, 0, len(seen))
+	for tok := range seen {
+		out = append(out, tok)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// splitTokens is the tokenizer shared by indexing and queries. A query
+// only needs the bigrams of a CJK run (or the character when it stands
+// alone); unigrams makes the index hold single characters too.
+func splitTokens(s string, unigrams bool) []string {
+	s = strings.ToLower(norm.NFKC.String(s))
+	var out []string
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			out = append(out, string(word))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		if len(han) == 1 || unigrams {
+			for _, r := range han {
+				out = append(out, string(r))
+			}
+		}
+		for i := 0; i+1 < len(han); i++ {
+			out = append(out, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	for _, r := range s {
+		switch {
+		case isHan(r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return out
+}
+
+// =========================
+// Thumbnails
+// =========================
+
+// thumbnail scales img down (box filter) so its longer side is at most
+// size pixels.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := float64(size) / float64(max(w, h))
+	if scale >= 1 {
+		scale = 1
+	}
+	tw, th := max(int(float64(w)*scale), 1), max(int(float64(h)*scale), 1)
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64 // a cell of a very tall capture overflows uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i+0] = uint8(r / n >> 8)
+			out.Pix[i+1] = uint8(g / n >> 8)
+			out.Pix[i+2] = uint8(bl / n >> 8)
+			out.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return out
+}
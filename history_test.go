@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// tallImage is a uniform image of any size without the pixel memory.
+type tallImage struct {
+	*image.Uniform
+	w, h int
+}
+
+func (t tallImage) Bounds() image.Rectangle { return image.Rect(0, 0, t.w, t.h) }
+
+func TestThumbnail(t *testing.T) {
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	grey := color.RGBA{0x80, 0x80, 0x80, 0xFF}
+	tests := []struct {
+		name       string
+		img        image.Image
+		wantW      int
+		wantH      int
+		wantColour color.RGBA
+	}{
+		{"small kept", tallImage{image.NewUniform(grey), 100, 50}, 100, 50, grey},
+		{"wide", tallImage{image.NewUniform(grey), 1280, 640}, 320, 160, grey},
+		// One thumbnail pixel averages 282 x 281 source pixels, more than
+		// a uint32 sum of 16-bit channels holds.
+		{"very tall", tallImage{image.NewUniform(white), 282, 90000}, 1, 320, white},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := thumbnail(tt.img, 320)
+			if got.Bounds().Dx() != tt.wantW || got.Bounds().Dy() != tt.wantH {
+				t.Fatalf("size %v, want %dx%d", got.Bounds().Size(), tt.wantW, tt.wantH)
+			}
+			for _, p := range []image.Point{{0, 0}, {tt.wantW - 1, tt.wantH - 1}} {
+				if c := got.RGBAAt(p.X, p.Y); c != tt.wantColour {
+					t.Errorf("pixel %v = %v, want %v", p, c, tt.wantColour)
+				}
+			}
+		})
+	}
+}
+
+func newTestHistory(t *testing.T, cfg historyConfig) *history {
+	t.Helper()
+	cfg.Path = filepath.Join(t.TempDir(), "history.db")
+	return newHistory(&cfg)
+}
+
+// addTexts stores one entry per text, a minute apart from start.
+func addTexts(t *testing.T, h *history, start time.Time, texts ...string) {
+	t.Helper()
+	for i, text := range texts {
+		out := &ocrOutput{Text: text, Time: start.Add(time.Duration(i) * time.Minute), Profile: "default"}
+		if _, err := h.add(out, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func entryIDs(entries []historyEntry) []uint64 {
+	ids := []uint64{}
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		unigrams bool
+		want     []string
+	}{
+		{"words", "Hello, World! 2024-05", true, []string{"hello", "world", "2024", "05"}},
+		{"full width folded", "ＯＣＲ　Ｔｅｓｔ", true, []string{"ocr", "test"}},
+		{"CJK index", "中文識別", true, []string{"中", "文", "識", "別", "中文", "文識", "識別"}},
+		{"CJK query", "中文識別", false, []string{"中文", "文識", "識別"}},
+		{"single CJK query", "中", false, []string{"中"}},
+		{"mixed", "OCR中文test", false, []string{"ocr", "中文", "test"}},
+		{"kana", "テスト", false, []string{"テス", "スト"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitTokens(tt.in, tt.unigrams); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := tokenize("b a b 中中"); !slices.Equal(got, []string{"a", "b", "中", "中中"}) {
+		t.Errorf("tokenize not unique and sorted: %q", got)
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := newTestHistory(t, historyConfig{})
+	addTexts(t, h, time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		"Meeting notes about the history export",
+		"中文識別測試",
+		"Invoice 2024 total 42",
+		"History of 中文 input",
+		"日本語のテキスト",
+	)
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{"hist", []uint64{4, 1}},        // prefix, newest first
+		{"HISTORY", []uint64{4, 1}},     // case-insensitive
+		{"history export", []uint64{1}}, // every token must match
+		{"history 中文", []uint64{4}},     // across scripts
+		{"中文", []uint64{4, 2}},          // bigram
+		{"文識", []uint64{2}},             // bigram inside a run
+		{"識", []uint64{2}},              // unigram
+		{"中文識別", []uint64{2}},           // every bigram of the query
+		{"中識", []uint64{}},              // characters present, but not adjacent
+		{"テキスト", []uint64{5}},           // kana
+		{"invoice 42", []uint64{3}},
+		{"invoice 43", []uint64{}},
+		{"exp notes", []uint64{1}},
+		{"missing", []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := h.search(tt.query, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := entryIDs(got); !slices.Equal(ids, tt.want) {
+				t.Errorf("ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if got, _ := h.search("hist", 1); !slices.Equal(entryIDs(got), []uint64{4}) {
+		t.Errorf("limit: ids = %v", entryIDs(got))
+	}
+	if _, err := h.search(" ,. ", 0); err == nil {
+		t.Error("empty query accepted")
+	}
+	if got, err := newTestHistory(t, historyConfig{}).search("hist", 0); err != nil || len(got) != 0 {
+		t.Errorf("missing database: %v, %v", got, err)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		cfg   historyConfig
+		times []time.Duration // after start
+		want  []uint64        // kept, newest first
+	}{
+		{"unlimited", historyConfig{}, []time.Duration{0, time.Minute, 2 * time.Minute}, []uint64{3, 2, 1}},
+		{"max_entries", historyConfig{MaxEntries: 2}, []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute}, []uint64{4, 3}},
+		{"max_age", historyConfig{MaxAge: duration(time.Hour)},
+			[]time.Duration{0, 30 * time.Minute, 70 * time.Minute, 90 * time.Minute}, []uint64{4, 3, 2}},
+		{"both", historyConfig{MaxEntries: 3, MaxAge: duration(time.Hour)},
+			[]time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 2 * time.Hour}, []uint64{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHistory(t, tt.cfg)
+			for i, d := range tt.times {
+				out := &ocrOutput{Text: fmt.Sprintf("entry%d common 記錄", i+1), Time: start.Add(d), Profile: "default"}
+				if _, err := h.add(out, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := h.list(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := entryIDs(got); !slices.Equal(ids, tt.want) {
+				t.Errorf("kept %v, want %v", ids, tt.want)
+			}
+			// Pruned entries leave nothing in the index.
+			found, err := h.search("common 記錄", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := entryIDs(found); !slices.Equal(ids, tt.want) {
+				t.Errorf("search finds %v, want %v", ids, tt.want)
+			}
+			if _, _, err := h.get(1); (err == nil) != slices.Contains(tt.want, 1) {
+				t.Errorf("get(1): %v", err)
+			}
+		})
+	}
+}
+
+func TestHistoryRemove(t *testing.T) {
+	h := newTestHistory(t, historyConfig{Thumbnails: true})
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i, text := range []string{"alpha 甲乙", "bravo 甲乙", "charlie"} {
+		out := &ocrOutput{Text: text, Time: start.Add(time.Duration(i) * time.Minute), Profile: "default"}
+		if _, err := h.add(out, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := h.remove([]uint64{2}); n != 1 || err != nil {
+		t.Fatalf("remove(2) = %d, %v", n, err)
+	}
+	if got, _ := h.search("甲乙", 0); !slices.Equal(entryIDs(got), []uint64{1}) {
+		t.Errorf("after delete, 甲乙 finds %v", entryIDs(got))
+	}
+	if got, _ := h.search("bravo", 0); len(got) != 0 {
+		t.Errorf("deleted entry still indexed: %v", entryIDs(got))
+	}
+	if _, _, err := h.get(2); err == nil {
+		t.Error("deleted entry still readable")
+	}
+	if _, thumb, err := h.get(3); err != nil || thumb == nil {
+		t.Errorf("get(3): thumb %d bytes, %v", len(thumb), err)
+	}
+	if _, err := h.remove([]uint64{2}); err == nil {
+		t.Error("deleting a missing entry succeeded")
+	}
+
+	if n, err := h.remove(nil); n != 2 || err != nil {
+		t.Fatalf("remove all = %d, %v", n, err)
+	}
+	if got, _ := h.list(0); len(got) != 0 {
+		t.Errorf("entries left: %v", entryIDs(got))
+	}
+	if got, _ := h.search("alpha", 0); len(got) != 0 {
+		t.Errorf("index left: %v", entryIDs(got))
+	}
+	addTexts(t, h, start, "delta")
+	if got, _ := h.search("delta", 0); len(got) != 1 {
+		t.Errorf("add after delete -all: %v", got)
+	}
+}
+
+// A redacted capture keeps its text but not its picture: the thumbnail
+// would still show what the rules removed.
+func TestHistoryNoThumbnailWhenRedacted(t *testing.T) {
+	r, err := (&redactConfig{}).compile("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHistory(t, historyConfig{Thumbnails: true})
+	img := image.NewRGBA(image.Rect(0, 0, 64, 16))
+	for i, text := range []string{"plain text", "mail bob@example.com"} {
+		res := &ocrResult{Text: text}
+		r.apply(res)
+		if res.Redacted != (i == 1) {
+			t.Fatalf("%q: Redacted = %v", text, res.Redacted)
+		}
+		id, err := h.add(newOCROutput(res, time.Now(), "default", screenRect{}), img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, thumb, err := h.get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := !res.Redacted; e.Thumb != want || (thumb != nil) != want {
+			t.Errorf("%q: thumb stored = %v, %d bytes, want %v", e.Text, e.Thumb, len(thumb), want)
+		}
+	}
+}
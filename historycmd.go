@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// =========================
+// history command
+// =========================
+
+const historyUsage = `usage: OcrBoard history <command> [options]
+
+commands:
+  list   [-n 20]                   newest entries
+  search [-n 20] <query>           full-text search (CJK aware)
+  show   [-thumb file.png] <id>    one entry; -thumb saves its thumbnail
+  delete <id>... | -all            delete entries
+  export [-format md|csv|jsonl|html] [-o file]
+         [-since 2006-01-02] [-until 2006-01-02] [-profile name]
+
+every command accepts -config <file>.
+`
+
+// runHistoryCommand runs "OcrBoard history ..." and returns the exit code.
+func runHistoryCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, historyUsage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("history "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "Config file")
+	limit := fs.Int("n", 20, "Max entries to print")
+	thumbPath := fs.String("thumb", "", "Write the entry's thumbnail PNG to this file")
+	all := fs.Bool("all", false, "Delete every entry")
+	format := fs.String("format", "md", "Export format: md, csv, jsonl or html")
+	outPath := fs.String("o", "", "Export to this file instead of stdout")
+	since := fs.String("since", "", "Export entries from this date (2006-01-02 or RFC 3339)")
+	until := fs.String("until", "", "Export entries up to this date, inclusive")
+	profileName := fs.String("profile", "", "Export only this profile's entries")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath, flagDefaults{})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	h := newHistory(cfg.History)
+	if h == nil {
+		fmt.Fprintln(stderr, "history is disabled in the config")
+		return 1
+	}
+
+	switch cmd {
+	case "list":
+		entries, err := h.list(*limit)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		printEntries(stdout, entries)
+
+	case "search":
+		entries, err := h.search(strings.Join(fs.Args(), " "), *limit)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		printEntries(stdout, entries)
+
+	case "show":
+		if fs.NArg() != 1 {
+			fmt.Fprint(stderr, historyUsage)
+			return 2
+		}
+		id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+		if err != nil {
+			fmt.Fprintf(stderr, "bad id %q\n", fs.Arg(0))
+			return 2
+		}
+		e, thumb, err := h.get(id)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "ID:      %d\n", e.ID)
+		fmt.Fprintf(stdout, "Time:    %s\n", e.Time.Format(time.RFC3339))
+		fmt.Fprintf(stdout, "Profile: %s\n", e.Profile)
+		fmt.Fprintf(stdout, "Backend: %s (%.3fs)\n", e.Backend, e.Latency.Seconds())
+		if t := e.Tokens; t.Total > 0 {
+			fmt.Fprintf(stdout, "Tokens:  %d prompt + %d completion = %d\n", t.Prompt, t.Completion, t.Total)
+		}
+		fmt.Fprintf(stdout, "Rect:    %d,%d %dx%d\n", e.Rect.X, e.Rect.Y, e.Rect.W, e.Rect.H)
+		fmt.Fprintf(stdout, "\n%s\n", e.Text)
+		if *thumbPath != "" {
+			if thumb == nil {
+				fmt.Fprintf(stderr, "entry %d has no thumbnail\n", id)
+				return 1
+			}
+			if err := os.WriteFile(*thumbPath, thumb, 0o644); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+		}
+
+	case "delete":
+		var ids []uint64
+		if !*all {
+			if fs.NArg() == 0 {
+				fmt.Fprint(stderr, historyUsage)
+				return 2
+			}
+			for _, a := range fs.Args() {
+				id, err := strconv.ParseUint(a, 10, 64)
+				if err != nil {
+					fmt.Fprintf(stderr, "bad id %q\n", a)
+					return 2
+				}
+				ids = append(ids, id)
+			}
+		}
+		n, err := h.remove(ids)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "deleted %d entries\n", n)
+
+	case "export":
+		var f historyFilter
+		var err error
+		if f.since, err = parseDay(*since, false); err == nil {
+			f.until, err = parseDay(*until, true)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		f.profile = *profileName
+		entries, err := h.export(f)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		w := stdout
+		if *outPath != "" {
+			file, err := os.Create(*outPath)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			defer file.Close()
+			w = file
+		}
+		if err := writeExport(w, *format, entries); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+	default:
+		fmt.Fprint(stderr, historyUsage)
+		return 2
+	}
+	return 0
+}
+
+// printEntries prints one line per entry: id, time, profile and the start
+// of the text.
+func printEntries(w io.Writer, entries []historyEntry) {
+	for _, e := range entries {
+		text := strings.Join(strings.Fields(e.Text), " ")
+		if utf8.RuneCountInString(text) > 60 {
+			text = string([]rune(text)[:60]) + "…"
+		}
+		fmt.Fprintf(w, "%6d  %s  %-10s  %s\n", e.ID, e.Time.Format("2006-01-02 15:04:05"), e.Profile, text)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// =========================
+// Hotkey strings ("Win+Alt+Shift+T")
+// =========================
+
+var (
+	MOD_ALT     uint32 = 0x0001
+	MOD_CONTROL uint32 = 0x0002
+	MOD_SHIFT   uint32 = 0x0004
+	MOD_WIN     uint32 = 0x0008
+)
+
+var hotkeyMods = map[string]uint32{
+	"alt":     MOD_ALT,
+	"ctrl":    MOD_CONTROL,
+	"control": MOD_CONTROL,
+	"shift":   MOD_SHIFT,
+	"win":     MOD_WIN,
+}
+
+var hotkeyKeys = map[string]uint32{
+	"backspace":   0x08,
+	"tab":         0x09,
+	"enter":       0x0D,
+	"pause":       0x13,
+	"esc":         0x1B,
+	"escape":      0x1B,
+	"space":       0x20,
+	"pageup":      0x21,
+	"pagedown":    0x22,
+	"end":         0x23,
+	"home":        0x24,
+	"left":        0x25,
+	"up":          0x26,
+	"right":       0x27,
+	"down":        0x28,
+	"printscreen": 0x2C,
+	"prtsc":       0x2C,
+	"insert":      0x2D,
+	"delete":      0x2E,
+}
+
+// parseHotkey turns "Win+Alt+Shift+T" into RegisterHotKey modifiers and a
+// virtual-key code. Names are case-insensitive; exactly one key is allowed.
+func parseHotkey(s string) (mods, vk uint32, err error) {
+	for _, part := range strings.Split(s, "+") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if m, ok := hotkeyMods[name]; ok {
+			mods |= m
+			continue
+		}
+		if vk != 0 {
+			return 0, 0, fmt.Errorf("hotkey %q: more than one key", s)
+		}
+		if vk = keyCode(name); vk == 0 {
+			return 0, 0, fmt.Errorf("hotkey %q: unknown key %q", s, part)
+		}
+	}
+	if vk == 0 {
+		return 0, 0, fmt.Errorf("hotkey %q: no key", s)
+	}
+	return mods, vk, nil
+}
+
+func keyCode(name string) uint32 {
+	if len(name) == 1 {
+		c := name[0]
+		switch {
+		case c >= 'a' && c <= 'z':
+			return uint32(c - 'a' + 'A')
+		case c >= '0' && c <= '9':
+			return uint32(c)
+		}
+	}
+	if len(name) > 1 && name[0] == 'f' {
+		if n, err := strconv.Atoi(name[1:]); err == nil && n >= 1 && n <= 24 {
+			return 0x70 + uint32(n-1) // VK_F1
+		}
+	}
+	return hotkeyKeys[name]
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// =========================
+// Layout from boxes
+// =========================
+
+// Layout modes for profile.Layout.
+const (
+	layoutText = ""     // use the backend's text as is
+	layoutCode = "code" // rebuild monospaced text from the boxes
+)
+
+func checkLayout(mode string) error {
+	switch mode {
+	case layoutText, layoutCode, layoutTSV, layoutCSV, layoutMarkdown:
+		return nil
+	}
+	return fmt.Errorf("layout %q: want code, tsv, csv or markdown", mode)
+}
+
+// applyLayout rebuilds the text of res from its boxes. Results without
+// boxes (servers that only send text) are left alone.
+func applyLayout(mode string, res *ocrResult) {
+	if mode == layoutText || len(res.Boxes) == 0 {
+		return
+	}
+	switch mode {
+	case layoutCode:
+		res.Text = layoutMonospace(res.Boxes)
+	case layoutTSV, layoutCSV, layoutMarkdown:
+		res.Text = formatTable(mode, buildTable(res.Boxes))
+	}
+}
+
+// boxRow is one visual line: boxes sorted left to right.
+type boxRow struct {
+	boxes       []ocrBox
+	top, bottom float64
+}
+
+func (r *boxRow) center() float64 { return (r.top + r.bottom) / 2 }
+
+// groupRows clusters boxes into visual lines. Boxes are taken top to
+// bottom; a box joins the last row when its vertical centre falls inside
+// that row's span, so slightly skewed lines still group together.
+func groupRows(boxes []ocrBox) []*boxRow {
+	sorted := append([]ocrBox(nil), boxes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Y+sorted[i].H/2 < sorted[j].Y+sorted[j].H/2
+	})
+
+	var rows []*boxRow
+	for _, b := range sorted {
+		if strings.TrimSpace(b.Text) == "" {
+			continue
+		}
+		cy := b.Y + b.H/2
+		if n := len(rows); n > 0 && cy >= rows[n-1].top && cy <= rows[n-1].bottom {
+			r := rows[n-1]
+			r.boxes = append(r.boxes, b)
+			r.top = math.Min(r.top, b.Y)
+			r.bottom = math.Max(r.bottom, b.Y+b.H)
+			continue
+		}
+		rows = append(rows, &boxRow{boxes: []ocrBox{b}, top: b.Y, bottom: b.Y + b.H})
+	}
+	for _, r := range rows {
+		sort.SliceStable(r.boxes, func(i, j int) bool { return r.boxes[i].X < r.boxes[j].X })
+	}
+	return rows
+}
+
+// cells is the monospaced width of s: East Asian wide characters take two
+// cells.
+func cells(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func median(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	return s[len(s)/2]
+}
+
+// charWidth estimates the width of one monospaced cell as the median of
+// box width / cell count. Short boxes are noisy, so they only count when
+// nothing longer is available.
+func charWidth(boxes []ocrBox) float64 {
+	var long, all []float64
+	for _, b := range boxes {
+		t := strings.TrimSpace(b.Text)
+		n := cells(t)
+		if n == 0 || b.W <= 0 {
+			continue
+		}
+		all = append(all, b.W/float64(n))
+		if n >= 4 {
+			long = append(long, b.W/float64(n))
+		}
+	}
+	if len(long) > 0 {
+		return median(long)
+	}
+	return median(all)
+}
+
+// layoutMonospace places every box at the column its x-offset maps to, so
+// indentation and column gaps survive. Vertical gaps of more than a line
+// become blank lines.
+func layoutMonospace(boxes []ocrBox) string {
+	rows := groupRows(boxes)
+	if len(rows) == 0 {
+		return ""
+	}
+	cw := charWidth(boxes)
+	if cw <= 0 {
+		cw = 1
+	}
+	x0 := math.Inf(1)
+	for _, r := range rows {
+		x0 = math.Min(x0, r.boxes[0].X)
+	}
+
+	// Line pitch: the median distance between neighbouring rows, but never
+	// less than a row is tall.
+	var gaps, heights []float64
+	for i, r := range rows {
+		heights = append(heights, r.bottom-r.top)
+		if i > 0 {
+			gaps = append(gaps, r.center()-rows[i-1].center())
+		}
+	}
+	pitch := median(gaps)
+	if h := median(heights); pitch < h {
+		pitch = h
+	}
+
+	var out []string
+	for i, r := range rows {
+		if i > 0 && pitch > 0 {
+			blank := int(math.Round((r.center()-rows[i-1].center())/pitch)) - 1
+			for ; blank > 0; blank-- {
+				out = append(out, "")
+			}
+		}
+
+		var line strings.Builder
+		col := 0
+		for j, b := range r.boxes {
+			t := strings.TrimSpace(b.Text)
+			want := int(math.Round((b.X - x0) / cw))
+			if j > 0 && want <= col {
+				want = col + 1 // keep neighbouring words apart
+			}
+			line.WriteString(strings.Repeat(" ", max(want-col, 0)))
+			line.WriteString(t)
+			col = max(want, col) + cells(t)
+		}
+		out = append(out, line.String())
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// monoBoxes lays text out on a monospaced grid (cw wide, 20 high, 24
+// apart) and returns one box per word, as a word-level OCR backend would.
+// skew shifts every other word down a little.
+func monoBoxes(text string, cw, skew float64) []ocrBox {
+	var boxes []ocrBox
+	for row, line := range strings.Split(text, "\n") {
+		col, n := 0, 0
+		for _, word := range strings.Split(line, " ") {
+			if word != "" {
+				y := float64(row) * 24
+				if n%2 == 1 {
+					y += skew
+				}
+				boxes = append(boxes, ocrBox{Text: word, X: 5 + float64(col)*cw, Y: y, W: float64(cells(word)) * cw, H: 20})
+				n++
+			}
+			col += cells(word) + 1
+		}
+	}
+	return boxes
+}
+
+func TestLayoutMonospace(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		skew float64
+	}{
+		{"indentation", "func main() {\n    if ok {\n        return\n    }\n}", 0},
+		{"blank lines", "package main\n\nimport (\n    \"fmt\"\n    \"os\"\n)\n\n\nvar (\n    x = 1\n    y = 2\n)", 0},
+		{"aligned columns", "name     size  mode\nmain.go  1200  0644\nREADME   80    0600", 0},
+		{"skewed words", "a := b + c\nreturn a  // sum", 3},
+		{"wide characters", "名前  = \"値\"\nkey   = 1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := layoutMonospace(monoBoxes(tt.text, 9, tt.skew)); got != tt.text {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestApplyLayoutWithoutBoxes(t *testing.T) {
+	res := &ocrResult{Text: "as sent"}
+	applyLayout(layoutCode, res)
+	if res.Text != "as sent" {
+		t.Errorf("text changed to %q", res.Text)
+	}
+}
@@ -3,16 +3,14 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"image"
-	"image/png"
-	"io"
-	"mime/multipart"
-	"net/http"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -23,12 +21,10 @@ import (
 )
 
 var (
-	// Hotkey: Win+Alt+Shift+T
-	MOD_ALT   uint32 = 0x0001
-	MOD_SHIFT uint32 = 0x0004
-	MOD_WIN   uint32 = 0x0008
-	VK_T      uint32 = 0x54
-	HOTKEY_ID int32  = 0xBEEF
+	// Hotkeys come from the config (see defaultConfig); binding i gets
+	// HOTKEY_ID+i. ESC cancels a scrolling capture.
+	HOTKEY_ID     int32 = 0xBEEF
+	HOTKEY_ESC_ID int32 = 0xBE00
 
 	// UI config
 	selectionBorderWidth = 5
@@ -81,6 +77,7 @@ var (
 	procCloseClipboard      = user32.NewProc("CloseClipboard")
 	procEmptyClipboard      = user32.NewProc("EmptyClipboard")
 	procSetClipboardData    = user32.NewProc("SetClipboardData")
+	procGetClipboardData    = user32.NewProc("GetClipboardData")
 	procPostThreadMessageW  = user32.NewProc("PostThreadMessageW")
 
 	procCreateCompatibleDC     = gdi32.NewProc("CreateCompatibleDC")
@@ -102,6 +99,7 @@ var (
 	procGlobalAlloc        = kernel32.NewProc("GlobalAlloc")
 	procGlobalLock         = kernel32.NewProc("GlobalLock")
 	procGlobalUnlock       = kernel32.NewProc("GlobalUnlock")
+	procGlobalSize         = kernel32.NewProc("GlobalSize")
 	procGetCurrentThreadId = kernel32.NewProc("GetCurrentThreadId")
 
 	procRtlMoveMemory = ntdll.NewProc("RtlMoveMemory")
@@ -351,86 +349,58 @@ func setClipboardText(s string) error {
 	return nil
 }
 
-// =========================
-// HTTP
-// =========================
-
-func postPNGAndGetOCR(url string, pngBytes []byte) (string, error) {
-	var body bytes.Buffer
-	w := multipart.NewWriter(&body)
-
-	fw, err := w.CreateFormFile("file", "capture.png")
-	if err != nil {
-		return "", err
-	}
-	if _, err := io.Copy(fw, bytes.NewReader(pngBytes)); err != nil {
-		return "", err
+func getClipboardText() (string, error) {
+	if r, _, _ := procOpenClipboard.Call(0); r == 0 {
+		return "", fmt.Errorf("OpenClipboard failed")
 	}
-	_ = w.Close()
+	defer procCloseClipboard.Call()
 
-	req, err := http.NewRequest("POST", url, &body)
-	if err != nil {
-		return "", err
+	hMem, _, _ := procGetClipboardData.Call(CF_UNICODETEXT)
+	if hMem == 0 {
+		return "", fmt.Errorf("no text on the clipboard")
 	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{Timeout: 60 * time.Second}
-
-	start := time.Now()
-	resp, err := client.Do(req)
-	elapsed := time.Since(start)
-
-	if err != nil {
-		fmt.Printf("[OCR] API returned: error (%.3fs)\n", elapsed.Seconds())
-		return "", err
+	size, _, _ := procGlobalSize.Call(hMem)
+	if size < 2 {
+		return "", nil
 	}
-	defer resp.Body.Close()
-
-	fmt.Printf("[OCR] API returned: %d (%.3fs)\n", resp.StatusCode, elapsed.Seconds())
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 800))
-		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(b))
+	ptr, _, _ := procGlobalLock.Call(hMem)
+	if ptr == 0 {
+		return "", fmt.Errorf("GlobalLock failed")
 	}
+	defer procGlobalUnlock.Call(hMem)
 
-	var out map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", err
-	}
-	if v, ok := out["ocr_result"]; ok {
-		if s, ok := v.(string); ok {
-			return s, nil
-		}
-	}
-	return "", fmt.Errorf("no ocr_result in response")
+	buf := make([]uint16, size/2)
+	procRtlMoveMemory.Call(uintptr(unsafe.Pointer(&buf[0])), ptr, uintptr(len(buf)*2))
+	return windows.UTF16ToString(buf), nil
 }
 
 // =========================
 // Screenshot
 // =========================
 
-func captureVirtualScreenRGBA() (*image.RGBA, int32, int32, int32, int32, error) {
-	vx := getSystemMetrics(SM_XVIRTUALSCREEN)
-	vy := getSystemMetrics(SM_YVIRTUALSCREEN)
-	vw := getSystemMetrics(SM_CXVIRTUALSCREEN)
-	vh := getSystemMetrics(SM_CYVIRTUALSCREEN)
+// captureRect grabs a rectangle of the virtual screen (virtual-screen
+// coordinates) straight into a pooled BGRA frame.
+func captureRect(x, y, w, h int32) (*frame, error) {
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("empty capture rectangle")
+	}
 
 	hdcScreen, _, _ := procGetDC.Call(0)
 	if hdcScreen == 0 {
-		return nil, 0, 0, 0, 0, fmt.Errorf("GetDC failed")
+		return nil, fmt.Errorf("GetDC failed")
 	}
 	defer procReleaseDC.Call(0, hdcScreen)
 
 	hdcMem, _, _ := procCreateCompatibleDC.Call(hdcScreen)
 	if hdcMem == 0 {
-		return nil, 0, 0, 0, 0, fmt.Errorf("CreateCompatibleDC failed")
+		return nil, fmt.Errorf("CreateCompatibleDC failed")
 	}
 	defer procDeleteDC.Call(hdcMem)
 
-	hbm, _, _ := procCreateCompatibleBitmap.Call(hdcScreen, uintptr(vw), uintptr(vh))
+	hbm, _, _ := procCreateCompatibleBitmap.Call(hdcScreen, uintptr(w), uintptr(h))
 	if hbm == 0 {
-		return nil, 0, 0, 0, 0, fmt.Errorf("CreateCompatibleBitmap failed")
+		return nil, fmt.Errorf("CreateCompatibleBitmap failed")
 	}
 	defer procDeleteObject.Call(hbm)
 
@@ -439,89 +409,58 @@ func captureVirtualScreenRGBA() (*image.RGBA, int32, int32, int32, int32, error)
 
 	ok, _, _ := procBitBlt.Call(
 		hdcMem,
-		0, 0, uintptr(vw), uintptr(vh),
+		0, 0, uintptr(w), uintptr(h),
 		hdcScreen,
-		uintptr(vx), uintptr(vy),
+		uintptr(x), uintptr(y),
 		SRCCOPY,
 	)
 	if ok == 0 {
-		return nil, 0, 0, 0, 0, fmt.Errorf("BitBlt failed")
+		return nil, fmt.Errorf("BitBlt failed")
 	}
 
 	var bi BITMAPINFO
 	bi.BmiHeader.BiSize = uint32(unsafe.Sizeof(bi.BmiHeader))
-	bi.BmiHeader.BiWidth = vw
-	bi.BmiHeader.BiHeight = -vh
+	bi.BmiHeader.BiWidth = w
+	bi.BmiHeader.BiHeight = -h
 	bi.BmiHeader.BiPlanes = 1
 	bi.BmiHeader.BiBitCount = 32
 	bi.BmiHeader.BiCompression = 0
 
-	buf := make([]byte, int(vw*vh*4))
+	fr := newFrame(x, y, w, h)
 
-	pBuf := unsafe.Pointer(&buf[0])
+	pBuf := unsafe.Pointer(&fr.Pix[0])
 	pBI := unsafe.Pointer(&bi)
 
 	r, _, _ := procGetDIBits.Call(
 		hdcMem,
 		hbm,
 		0,
-		uintptr(vh),
+		uintptr(h),
 		uintptr(pBuf),
 		uintptr(pBI),
 		0,
 	)
 
-	runtime.KeepAlive(buf)
+	runtime.KeepAlive(fr.Pix)
 	runtime.KeepAlive(&bi)
 
 	if r == 0 {
-		return nil, 0, 0, 0, 0, fmt.Errorf("GetDIBits failed")
-	}
-
-	img := image.NewRGBA(image.Rect(0, 0, int(vw), int(vh)))
-	for i := 0; i < len(buf); i += 4 {
-		b := buf[i+0]
-		g := buf[i+1]
-		rr := buf[i+2]
-		a := buf[i+3]
-		img.Pix[i+0] = rr
-		img.Pix[i+1] = g
-		img.Pix[i+2] = b
-		img.Pix[i+3] = a
+		fr.release()
+		return nil, fmt.Errorf("GetDIBits failed")
 	}
-
-	return img, vx, vy, vw, vh, nil
+	return fr, nil
 }
 
-func cropRGBA(img *image.RGBA, vx, vy int32, l, t, r, b int32) *image.RGBA {
-	lx := int(l - vx)
-	ty := int(t - vy)
-	rx := int(r - vx)
-	by := int(b - vy)
-
-	if lx < 0 {
-		lx = 0
-	}
-	if ty < 0 {
-		ty = 0
-	}
-	if rx > img.Bounds().Dx() {
-		rx = img.Bounds().Dx()
-	}
-	if by > img.Bounds().Dy() {
-		by = img.Bounds().Dy()
-	}
-	if rx <= lx || by <= ty {
-		return nil
-	}
+func virtualScreenRect() (x, y, w, h int32) {
+	x = getSystemMetrics(SM_XVIRTUALSCREEN)
+	y = getSystemMetrics(SM_YVIRTUALSCREEN)
+	w = getSystemMetrics(SM_CXVIRTUALSCREEN)
+	h = getSystemMetrics(SM_CYVIRTUALSCREEN)
+	return
+}
 
-	dst := image.NewRGBA(image.Rect(0, 0, rx-lx, by-ty))
-	for y := ty; y < by; y++ {
-		srcOff := img.PixOffset(lx, y)
-		dstOff := dst.PixOffset(0, y-ty)
-		copy(dst.Pix[dstOff:dstOff+(rx-lx)*4], img.Pix[srcOff:srcOff+(rx-lx)*4])
-	}
-	return dst
+func captureVirtualScreen() (*frame, error) {
+	return captureRect(virtualScreenRect())
 }
 
 // =========================
@@ -530,7 +469,7 @@ func cropRGBA(img *image.RGBA, vx, vy int32, l, t, r, b int32) *image.RGBA {
 
 type selectionState struct {
 	vx, vy, vw, vh int32
-	img            *image.RGBA
+	fr             *frame
 
 	dragging bool
 	x1, y1   int32
@@ -540,8 +479,6 @@ type selectionState struct {
 	canceled bool
 	hwnd     uintptr
 
-	bgra []byte
-
 	// ===== Double buffer =====
 	backDC  uintptr
 	backBmp uintptr
@@ -609,26 +546,6 @@ func packBlend(alpha byte) uintptr {
 	return uintptr(v)
 }
 
-func (s *selectionState) ensureBGRA() {
-	if s.bgra != nil {
-		return
-	}
-	w := int(s.vw)
-	h := int(s.vh)
-	bg := make([]byte, w*h*4)
-	for i := 0; i < len(bg); i += 4 {
-		r := s.img.Pix[i+0]
-		g := s.img.Pix[i+1]
-		b := s.img.Pix[i+2]
-		a := s.img.Pix[i+3]
-		bg[i+0] = b
-		bg[i+1] = g
-		bg[i+2] = r
-		bg[i+3] = a
-	}
-	s.bgra = bg
-}
-
 func (s *selectionState) ensureBuffers(paintHdc uintptr) {
 	if s.backDC != 0 && s.blackDC != 0 {
 		return
@@ -737,7 +654,6 @@ func (s *selectionState) paint(hwnd uintptr) {
 		runtime.KeepAlive(&ps)
 	}()
 
-	s.ensureBGRA()
 	s.ensureBuffers(hdc)
 
 	dst := s.backDC
@@ -756,7 +672,7 @@ func (s *selectionState) paint(hwnd uintptr) {
 	bi.BmiHeader.BiBitCount = 32
 	bi.BmiHeader.BiCompression = 0
 
-	pBits := unsafe.Pointer(&s.bgra[0])
+	pBits := unsafe.Pointer(&s.fr.Pix[0])
 	pBI := unsafe.Pointer(&bi)
 
 	procStretchDIBits.Call(
@@ -768,7 +684,7 @@ func (s *selectionState) paint(hwnd uintptr) {
 		0,
 		SRCCOPY,
 	)
-	runtime.KeepAlive(s.bgra)
+	runtime.KeepAlive(s.fr.Pix)
 	runtime.KeepAlive(&bi)
 
 	l, t, r, b := rectNorm(s.x1-s.vx, s.y1-s.vy, s.x2-s.vx, s.y2-s.vy)
@@ -892,7 +808,9 @@ func selectionWndProc(hwnd uintptr, msg uint32, wParam, lParam uintptr) uintptr
 	return ret
 }
 
-func runSelectionWindow(img *image.RGBA, vx, vy, vw, vh int32) (l, t, r, b int32, canceled bool, err error) {
+func runSelectionWindow(fr *frame) (l, t, r, b int32, canceled bool, err error) {
+	vx, vy, vw, vh := fr.X, fr.Y, fr.W, fr.H
+
 	hInstance := getModuleHandle()
 	className := mustUTF16Ptr("OcrBoard_SelectionWindow")
 
@@ -927,7 +845,7 @@ func runSelectionWindow(img *image.RGBA, vx, vy, vw, vh int32) (l, t, r, b int32
 		return 0, 0, 0, 0, true, fmt.Errorf("CreateWindowExW failed")
 	}
 
-	st := &selectionState{vx: vx, vy: vy, vw: vw, vh: vh, img: img}
+	st := &selectionState{vx: vx, vy: vy, vw: vw, vh: vh, fr: fr}
 	attachState(hwnd, st)
 
 	procSetWindowPos.Call(hwnd, HWND_TOPMOST, 0, 0, 0, 0, SWP_NOMOVE|SWP_NOSIZE|SWP_SHOWWINDOW)
@@ -960,81 +878,452 @@ func runSelectionWindow(img *image.RGBA, vx, vy, vw, vh int32) (l, t, r, b int32
 // Hotkey register (MUST be called on main OS thread)
 // =========================
 
-func registerHotkey() error {
-	r, _, _ := procRegisterHotKey.Call(0, uintptr(HOTKEY_ID), uintptr(MOD_WIN|MOD_ALT|MOD_SHIFT), uintptr(VK_T))
+func registerHotkeyID(id int32, mods, vk uint32) error {
+	r, _, _ := procRegisterHotKey.Call(0, uintptr(id), uintptr(mods), uintptr(vk))
 	if r == 0 {
 		return fmt.Errorf("RegisterHotKey failed (maybe occupied)")
 	}
 	return nil
 }
 
-func unregisterHotkey() {
-	_, _, _ = procUnregisterHotKey.Call(0, uintptr(HOTKEY_ID))
+// registerHotkeys registers the configured hotkeys; ESC is only taken while
+// a scrolling capture is in progress.
+func registerHotkeys(bindings []*hotkeyBinding, scrolling bool) error {
+	for i, hk := range bindings {
+		if err := registerHotkeyID(HOTKEY_ID+int32(i), hk.mods, hk.vk); err != nil {
+			return fmt.Errorf("%s: %w", hk.Keys, err)
+		}
+	}
+	if scrolling {
+		return registerHotkeyID(HOTKEY_ESC_ID, 0, VK_ESCAPE)
+	}
+	return nil
+}
+
+func unregisterHotkeys(bindings []*hotkeyBinding) {
+	for i := range bindings {
+		_, _, _ = procUnregisterHotKey.Call(0, uintptr(HOTKEY_ID+int32(i)))
+	}
+	_, _, _ = procUnregisterHotKey.Call(0, uintptr(HOTKEY_ESC_ID))
 }
 
 // =========================
 // UI thread worker
 // =========================
 
+type uiAction int
+
+const (
+	actionSelectOCR uiAction = iota
+	actionRepeatOCR
+	actionScrollBegin
+	actionScrollGrab
+	actionScrollFinish
+	actionScrollCancel
+	actionWatch
+	actionWatchStop
+	actionSubtitle
+	actionConvert
+)
+
 type uiRequest struct {
-	apiURL       string
+	action       uiAction
+	profile      *profile
+	convert      string // OpenCC conversion for actionConvert
 	mainThreadID uint32
 }
 
-func uiThreadLoop(reqCh <-chan uiRequest) {
+// hotkeyAction maps a hotkey to what the UI thread should do. While a
+// scrolling capture is open, an OCR hotkey finishes it instead of starting
+// a new selection.
+func hotkeyAction(bindings []*hotkeyBinding, id int32, scrolling bool) (uiRequest, bool) {
+	if id == HOTKEY_ESC_ID {
+		return uiRequest{action: actionScrollCancel}, scrolling
+	}
+	i := int(id - HOTKEY_ID)
+	if i < 0 || i >= len(bindings) {
+		return uiRequest{}, false
+	}
+	hk := bindings[i]
+	req := uiRequest{profile: hk.profile}
+	switch hk.Action {
+	case actionNameOCR:
+		req.action = actionSelectOCR
+		if scrolling {
+			req.action = actionScrollFinish
+		}
+	case actionNameScroll:
+		req.action = actionScrollBegin
+		if scrolling {
+			req.action = actionScrollGrab
+		}
+	case actionNameRepeat:
+		req.action = actionRepeatOCR
+	case actionNameWatch:
+		req.action = actionWatch
+	case actionNameWatchStop:
+		return uiRequest{action: actionWatchStop, profile: hk.profile}, true
+	case actionNameSubtitle:
+		req.action = actionSubtitle
+	case actionNameConvert:
+		return uiRequest{action: actionConvert, profile: hk.profile, convert: hk.Convert}, true
+	default:
+		return uiRequest{}, false
+	}
+	// Only the scroll and OCR hotkeys act while a scrolling capture is open.
+	if scrolling && req.action != actionScrollFinish && req.action != actionScrollGrab {
+		return uiRequest{}, false
+	}
+	return req, true
+}
+
+// scrollSession keeps the frames of a scrolling capture between hotkey
+// presses. The region is fixed by the first selection.
+type scrollSession struct {
+	l, t, r, b int32
+	frames     []*image.RGBA
+}
+
+// selectRegion shows the selection overlay over a fresh screenshot and
+// returns the selected crop, or nil when the user canceled.
+func selectRegion() (crop *image.RGBA, l, t, r, b int32, err error) {
+	fr, err := captureVirtualScreen()
+	if err != nil {
+		return nil, 0, 0, 0, 0, err
+	}
+	defer fr.release()
+
+	l, t, r, b, canceled, err := runSelectionWindow(fr)
+	if err != nil || canceled {
+		return nil, 0, 0, 0, 0, err
+	}
+	return fr.cropRGBA(l, t, r, b), l, t, r, b, nil
+}
+
+// rememberRegion stores the selection as the profile's last region.
+func rememberRegion(st *appState, p *profile, l, t, r, b int32) {
+	w, h := rectWH(l, t, r, b)
+	vx, vy, vw, vh := virtualScreenRect()
+	saved := savedRegion{
+		Rect:   screenRect{X: l, Y: t, W: w, H: h},
+		Screen: screenRect{X: vx, Y: vy, W: vw, H: vh},
+	}
+	if err := st.setRegion(p.Name, saved); err != nil {
+		fmt.Printf("[OCR] state: %v\n", err)
+	}
+}
+
+// lastRegion returns the profile's last region fitted onto the current
+// monitor layout. A region that fell off screen is forgotten.
+func lastRegion(st *appState, p *profile) (l, t, r, b int32, err error) {
+	saved, ok := st.region(p.Name)
+	if !ok {
+		return 0, 0, 0, 0, fmt.Errorf("no previous region for profile %q; select one first", p.Name)
+	}
+	vx, vy, vw, vh := virtualScreenRect()
+	rc, clamped, ok := resolveRegion(saved, screenRect{X: vx, Y: vy, W: vw, H: vh})
+	if !ok {
+		_ = st.clearRegion(p.Name)
+		return 0, 0, 0, 0, fmt.Errorf("the last region of profile %q is no longer on screen; select a new one", p.Name)
+	}
+	if clamped {
+		fmt.Printf("[OCR] Screen layout changed; last region clamped to %dx%d\n", rc.W, rc.H)
+	}
+	return rc.X, rc.Y, rc.right(), rc.bottom(), nil
+}
+
+func grabRegion(l, t, r, b int32) (*image.RGBA, error) {
+	w, h := rectWH(l, t, r, b)
+	fr, err := captureRect(l, t, w, h)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.release()
+	return fr.rgba(), nil
+}
+
+// maskCrop paints the profile's masks over a crop whose top-left pixel is
+// at (l, t) and audits it when anything was masked.
+func maskCrop(p *profile, img *image.RGBA, l, t int32) {
+	if hits := p.maskCapture(img, l, t); len(hits) > 0 {
+		b := img.Bounds()
+		auditMasks(p.Name, screenRect{X: l, Y: t, W: int32(b.Dx()), H: int32(b.Dy())}, hits)
+	}
+}
+
+// regionSource grabs a fixed rectangle of the virtual screen and masks it.
+// Continuous jobs grab every interval, so the audit log only gets an entry
+// when the number of masked areas changes.
+type regionSource struct {
+	l, t, r, b int32
+	p          *profile
+	masked     int
+}
+
+func (s *regionSource) grab() (*image.RGBA, error) {
+	img, err := grabRegion(s.l, s.t, s.r, s.b)
+	if err != nil {
+		return nil, err
+	}
+	hits := s.p.maskCapture(img, s.l, s.t)
+	if len(hits) != s.masked && len(hits) > 0 {
+		auditMasks(s.p.Name, rectLTRB(s.l, s.t, s.r, s.b), hits)
+	}
+	s.masked = len(hits)
+	return img, nil
+}
+
+// startWatch runs a watcher for the region on its own OS thread (GDI DCs
+// must be released on the thread that got them) until cancel is called.
+func startWatch(p *profile, hist *history, l, t, r, b int32) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{
+		src: &regionSource{l: l, t: t, r: r, b: b, p: p},
+		cfg: p.watch,
+		now: time.Now,
+		ocr: p.recognize,
+		emit: func(ev watchEvent) {
+			out := newOCROutput(ev.Result, ev.Time, p.Name, rectLTRB(l, t, r, b))
+			_ = deliver(ctx, profileSinks(p, true), out)
+			hist.record(out, nil)
+		},
+	}
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		w.run(ctx, func(err error) {
+			fmt.Printf("[OCR] Watch (%s) error: %v\n", p.Name, err)
+		})
+	}()
+	fmt.Printf("[OCR] Watch (%s) started: every %s, threshold %g\n", p.Name, time.Duration(p.watch.Interval), p.watch.Threshold)
+	return cancel
+}
+
+// startSubtitles records subtitles from the region until cancel is called,
+// then writes the SRT/WebVTT file.
+func startSubtitles(p *profile, l, t, r, b int32) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := &subtitleRecorder{
+		src: &regionSource{l: l, t: t, r: r, b: b, p: p},
+		cfg: p.subtitle,
+		now: time.Now,
+		ocr: func(ctx context.Context, img *image.RGBA) (string, error) {
+			res, err := p.recognize(ctx, img)
+			if err != nil {
+				return "", err
+			}
+			return res.Text, nil
+		},
+	}
+	started := time.Now()
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		cues := rec.run(ctx, func(err error) {
+			fmt.Printf("[OCR] Subtitles (%s) error: %v\n", p.Name, err)
+		})
+		path, err := saveSubtitles(p.subtitle, started, cues)
+		if err != nil {
+			fmt.Printf("[OCR] Subtitles (%s) error: %v\n", p.Name, err)
+			return
+		}
+		fmt.Printf("[OCR] Subtitles (%s): %d cues written to %s\n", p.Name, len(cues), path)
+	}()
+	fmt.Printf("[OCR] Subtitles (%s) recording: every %s\n", p.Name, time.Duration(p.subtitle.Interval))
+	return cancel
+}
+
+// defaultSinks and backgroundSinks are built in main by initSinks.
+var defaultSinks, backgroundSinks []*outputSink
+
+func initSinks() (err error) {
+	if defaultSinks, err = newSinks([]sinkConfig{{Type: "clipboard"}, {Type: "messagebox"}}); err != nil {
+		return fmt.Errorf("default sinks: %w", err)
+	}
+	if backgroundSinks, err = newSinks([]sinkConfig{{Type: "stdout"}, {Type: "clipboard"}}); err != nil {
+		return fmt.Errorf("background sinks: %w", err)
+	}
+	return nil
+}
+
+// profileSinks returns where a profile's results go. Without configured
+// sinks, interactive captures go to the clipboard and a message box, and
+// background ones (watch mode) to the console and the clipboard.
+func profileSinks(p *profile, background bool) []*outputSink {
+	if p.sinks != nil {
+		return p.sinks
+	}
+	if background {
+		return backgroundSinks
+	}
+	return defaultSinks
+}
+
+func ocrAndShow(req uiRequest, img *image.RGBA, rect screenRect, hist *history) {
+	res, err := req.profile.recognize(context.Background(), img)
+	if err != nil {
+		messageBoxTop("OCR Error", err.Error())
+		return
+	}
+
+	out := newOCROutput(res, time.Now(), req.profile.Name, rect)
+	hist.record(out, img)
+	if err := deliver(context.Background(), profileSinks(req.profile, false), out); err != nil {
+		messageBoxTop("OCR Error", err.Error())
+	}
+}
+
+// convertClipboard converts the clipboard text (usually the last OCR
+// result) between Simplified and Traditional Chinese and hands it to the
+// profile's sinks.
+func convertClipboard(req uiRequest) {
+	text, err := getClipboardText()
+	if err != nil {
+		messageBoxTop("OCR Error", err.Error())
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	converted, err := convertChinese(req.convert, text)
+	if err != nil {
+		messageBoxTop("OCR Error", err.Error())
+		return
+	}
+	fmt.Printf("[OCR] Converted clipboard text (%s)\n", req.convert)
+
+	out := &ocrOutput{Text: converted, Time: time.Now(), Profile: req.profile.Name}
+	if err := deliver(context.Background(), profileSinks(req.profile, false), out); err != nil {
+		messageBoxTop("OCR Error", err.Error())
+	}
+}
+
+func uiThreadLoop(reqCh <-chan uiRequest, st *appState, hist *history) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
+	var scroll *scrollSession
+	// Running watches and subtitle recordings, toggled by their hotkey.
+	type runKey struct {
+		p      *profile
+		action uiAction
+	}
+	running := make(map[runKey]context.CancelFunc)
+
 	for req := range reqCh {
 		func() {
 			defer func() {
 				// notify main thread: UI done -> re-register hotkey
-				procPostThreadMessageW.Call(uintptr(req.mainThreadID), WM_UI_DONE, 0, 0)
+				// (wParam = 1 while a scrolling capture stays open)
+				var scrolling uintptr
+				if scroll != nil {
+					scrolling = 1
+				}
+				procPostThreadMessageW.Call(uintptr(req.mainThreadID), WM_UI_DONE, scrolling, 0)
 			}()
 
-			img, vx, vy, vw, vh, err := captureVirtualScreenRGBA()
-			if err != nil {
-				messageBoxTop("OCR Error", err.Error())
-				return
-			}
-
-			l, t, r, b, canceled, err := runSelectionWindow(img, vx, vy, vw, vh)
-			if err != nil {
-				messageBoxTop("OCR Error", err.Error())
-				return
-			}
-			if canceled {
-				return
-			}
-
-			crop := cropRGBA(img, vx, vy, l, t, r, b)
-			if crop == nil {
-				return
-			}
-
-			var buf bytes.Buffer
-			if err := png.Encode(&buf, crop); err != nil {
-				messageBoxTop("OCR Error", err.Error())
-				return
-			}
-
-			ocrText, err := postPNGAndGetOCR(req.apiURL, buf.Bytes())
-			if err != nil {
-				messageBoxTop("OCR Error", err.Error())
-				return
-			}
+			switch req.action {
+			case actionSelectOCR:
+				crop, l, t, r, b, err := selectRegion()
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				if crop == nil {
+					return
+				}
+				rememberRegion(st, req.profile, l, t, r, b)
+				maskCrop(req.profile, crop, l, t)
+				ocrAndShow(req, crop, rectLTRB(l, t, r, b), hist)
+
+			case actionRepeatOCR:
+				l, t, r, b, err := lastRegion(st, req.profile)
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				img, err := grabRegion(l, t, r, b)
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				maskCrop(req.profile, img, l, t)
+				ocrAndShow(req, img, rectLTRB(l, t, r, b), hist)
+
+			case actionScrollBegin:
+				crop, l, t, r, b, err := selectRegion()
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				if crop == nil {
+					return
+				}
+				rememberRegion(st, req.profile, l, t, r, b)
+				scroll = &scrollSession{l: l, t: t, r: r, b: b, frames: []*image.RGBA{crop}}
+				fmt.Printf("[OCR] Scroll capture: frame 1. Scroll, then press the scroll hotkey to grab; an OCR hotkey finishes; ESC cancels.\n")
+
+			case actionScrollGrab:
+				img, err := grabRegion(scroll.l, scroll.t, scroll.r, scroll.b)
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				scroll.frames = append(scroll.frames, img)
+				fmt.Printf("[OCR] Scroll capture: frame %d\n", len(scroll.frames))
+
+			case actionScrollFinish:
+				frames := scroll.frames
+				rect := rectLTRB(scroll.l, scroll.t, scroll.r, scroll.b)
+				scroll = nil
+				img, hits, err := req.profile.maskScroll(frames, rect.X, rect.Y)
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				fmt.Printf("[OCR] Scroll capture: stitched %d frames into %dx%d\n", len(frames), img.Bounds().Dx(), img.Bounds().Dy())
+				if len(hits) > 0 {
+					auditMasks(req.profile.Name, screenRect{X: rect.X, Y: rect.Y, W: int32(img.Bounds().Dx()), H: int32(img.Bounds().Dy())}, hits)
+				}
+				ocrAndShow(req, img, rect, hist)
+
+			case actionScrollCancel:
+				scroll = nil
+				fmt.Printf("[OCR] Scroll capture canceled\n")
+
+			case actionWatch, actionSubtitle:
+				key := runKey{req.profile, req.action}
+				if stop, ok := running[key]; ok {
+					stop()
+					delete(running, key)
+					fmt.Printf("[OCR] Stopped (%s)\n", req.profile.Name)
+					return
+				}
+				crop, l, t, r, b, err := selectRegion()
+				if err != nil {
+					messageBoxTop("OCR Error", err.Error())
+					return
+				}
+				if crop == nil {
+					return
+				}
+				rememberRegion(st, req.profile, l, t, r, b)
+				if req.action == actionWatch {
+					running[key] = startWatch(req.profile, hist, l, t, r, b)
+				} else {
+					running[key] = startSubtitles(req.profile, l, t, r, b)
+				}
 
-			_ = setClipboardText(ocrText)
+			case actionConvert:
+				convertClipboard(req)
 
-			msg := ocrText
-			if msg == "" {
-				msg = "(empty)"
-			}
-			runes := []rune(msg)
-			if len(runes) > 2000 {
-				msg = string(runes[:2000]) + "\n\n...(Content truncated. Full text has been copied to the clipboard)"
+			case actionWatchStop:
+				for key, stop := range running {
+					stop()
+					delete(running, key)
+					fmt.Printf("[OCR] Stopped (%s)\n", key.p.Name)
+				}
 			}
-			messageBoxTop("OCR Result (Copied to clipboard)", msg)
 		}()
 	}
 }
@@ -1044,6 +1333,10 @@ func uiThreadLoop(reqCh <-chan uiRequest) {
 // =========================
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(runHistoryCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Hotkey loop must be on a fixed OS thread
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -1053,30 +1346,50 @@ func main() {
 	ip := flag.String("ip", "127.0.0.1", "Server IP")
 	port := flag.Int("port", 8000, "Server Port")
 	path := flag.String("path", "/upload", "API path")
-	url := flag.String("url", "", "Full API URL (overrides -ip/-port/-path)")
+	url := flag.String("url", "", "Full API URL (overrides -ip/-port/-path); comma-separated for several servers")
+	workers := flag.Int("workers", 4, "Max concurrent OCR requests")
+	tileHeight := flag.Int("tile-height", 1600, "Split selections taller than this (px) into strips; 0 disables")
+	configPath := flag.String("config", "", "Config file (default: %APPDATA%\\OcrBoard\\config.json if present)")
 	flag.Parse()
 
-	apiURL := *url
-	if apiURL == "" {
-		apiURL = fmt.Sprintf("http://%s:%d%s", *ip, *port, *path)
+	apiURLs := parseURLList(*url)
+	if len(apiURLs) == 0 {
+		apiURLs = []string{fmt.Sprintf("http://%s:%d%s", *ip, *port, *path)}
 	}
+	cfg, err := loadConfig(*configPath, flagDefaults{servers: apiURLs, workers: *workers, tileHeight: *tileHeight})
+	if err == nil {
+		err = initSinks()
+	}
+	if err != nil {
+		messageBoxTop("OCR Error", err.Error())
+		return
+	}
+	st := loadState(filepath.Join(configDir(), "state.json"))
 
-	fmt.Printf("[OCR] Hotkey ready: Win+Alt+Shift+T\n")
-	fmt.Printf("[OCR] API: %s\n", apiURL)
+	if cfg.path != "" {
+		fmt.Printf("[OCR] Config: %s\n", cfg.path)
+	}
+	for _, hk := range cfg.Hotkeys {
+		fmt.Printf("[OCR] Hotkey ready: %s (%s, profile %s)\n", hk.Keys, hk.Action, hk.profile.Name)
+	}
+	for _, p := range cfg.Profiles {
+		fmt.Printf("[OCR] API (%s): %s\n", p.Name, p.pool)
+	}
 	fmt.Printf("[OCR] ESC cancels selection (Win32).\n")
 
 	mainThreadID := getCurrentThreadId()
 
 	reqCh := make(chan uiRequest, 1)
-	go uiThreadLoop(reqCh)
+	go uiThreadLoop(reqCh, st, newHistory(cfg.History))
 
-	if err := registerHotkey(); err != nil {
+	if err := registerHotkeys(cfg.Hotkeys, false); err != nil {
 		messageBoxTop("OCR Error", err.Error())
 		return
 	}
-	defer unregisterHotkey()
+	defer unregisterHotkeys(cfg.Hotkeys)
 
 	capturing := false
+	scrolling := false
 
 	var msg MSG
 	for {
@@ -1090,19 +1403,22 @@ func main() {
 
 		switch msg.Message {
 		case WM_HOTKEY:
-			if int32(msg.WParam) == HOTKEY_ID && !capturing {
+			req, ok := hotkeyAction(cfg.Hotkeys, int32(msg.WParam), scrolling)
+			if ok && !capturing {
 				capturing = true
 
 				// 1) selector 開啟前先 UnregisterHotKey
-				unregisterHotkey()
+				unregisterHotkeys(cfg.Hotkeys)
 
 				// 2) selector 跑在 UI thread
-				reqCh <- uiRequest{apiURL: apiURL, mainThreadID: mainThreadID}
+				req.mainThreadID = mainThreadID
+				reqCh <- req
 			}
 
 		case WM_UI_DONE:
 			// selector 結束後再 RegisterHotKey
-			_ = registerHotkey()
+			scrolling = msg.WParam != 0
+			_ = registerHotkeys(cfg.Hotkeys, scrolling)
 			capturing = false
 		}
 
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =========================
+// Image masks
+// =========================
+
+// maskConfig is one entry of a profile's "masks": a fixed rectangle in
+// virtual-screen coordinates, every area of a colour, or every place a
+// template image appears. Matches are painted over before upload.
+type maskConfig struct {
+	Rect *screenRect `json:"rect,omitempty"`
+
+	Color     string `json:"color,omitempty"`      // "#rrggbb"
+	Tolerance int    `json:"tolerance,omitempty"`  // per channel, default 12
+	MinPixels int    `json:"min_pixels,omitempty"` // smallest area that counts, default 50
+
+	Template  string  `json:"template,omitempty"`  // PNG/JPEG file
+	Threshold float64 `json:"threshold,omitempty"` // similarity 0..1, default 0.95
+
+	Pad  int    `json:"pad,omitempty"`  // grow matches by this many pixels
+	Fill string `json:"fill,omitempty"` // "#rrggbb", default black
+}
+
+type imageMask struct {
+	kind      string // "rect", "color", "template"
+	rect      image.Rectangle
+	color     color.RGBA
+	tolerance int
+	minPixels int
+	tmpl      *image.Gray
+	threshold float64
+	pad       int
+	fill      *image.Uniform
+}
+
+// maskHit is a painted area in virtual-screen coordinates.
+type maskHit struct {
+	Kind string     `json:"kind"`
+	Rect screenRect `json:"rect"`
+}
+
+func compileMasks(cfgs []maskConfig) ([]*imageMask, error) {
+	var out []*imageMask
+	for i, c := range cfgs {
+		m, err := compileMask(c)
+		if err != nil {
+			return nil, fmt.Errorf("mask %d: %w", i+1, err)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func compileMask(c maskConfig) (*imageMask, error) {
+	m := &imageMask{pad: c.Pad, fill: image.NewUniform(color.RGBA{A: 255})}
+	if c.Fill != "" {
+		fill, err := parseHexColor(c.Fill)
+		if err != nil {
+			return nil, err
+		}
+		m.fill = image.NewUniform(fill)
+	}
+
+	kinds := 0
+	if c.Rect != nil {
+		kinds++
+		m.kind = "rect"
+		m.rect = image.Rect(int(c.Rect.X), int(c.Rect.Y), int(c.Rect.right()), int(c.Rect.bottom()))
+	}
+	if c.Color != "" {
+		kinds++
+		m.kind = "color"
+		var err error
+		if m.color, err = parseHexColor(c.Color); err != nil {
+			return nil, err
+		}
+		m.tolerance, m.minPixels = c.Tolerance, c.MinPixels
+		if m.tolerance <= 0 {
+			m.tolerance = 12
+		}
+		if m.minPixels <= 0 {
+			m.minPixels = 50
+		}
+	}
+	if c.Template != "" {
+		kinds++
+		m.kind = "template"
+		tmpl, err := loadTemplate(c.Template)
+		if err != nil {
+			return nil, err
+		}
+		m.tmpl = tmpl
+		m.threshold = c.Threshold
+		if m.threshold <= 0 {
+			m.threshold = 0.95
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("want exactly one of rect, color or template")
+	}
+	return m, nil
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(s, "#")) != 6 {
+		return color.RGBA{}, fmt.Errorf("colour %q: want #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+func loadTemplate(path string) (*image.Gray, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", path, err)
+	}
+	g := image.NewGray(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(g, g.Bounds(), img, img.Bounds().Min, draw.Src)
+	return g, nil
+}
+
+// applyMasks paints the masks over img, a crop whose top-left pixel sits
+// at origin in virtual-screen coordinates, and returns what was painted.
+func applyMasks(masks []*imageMask, img *image.RGBA, origin image.Point) []maskHit {
+	var hits []maskHit
+	for _, m := range masks {
+		var areas []image.Rectangle // in img coordinates
+		switch m.kind {
+		case "rect":
+			areas = []image.Rectangle{m.rect.Sub(origin).Add(img.Bounds().Min)}
+		case "color":
+			areas = colorAreas(img, m.color, m.tolerance, m.minPixels)
+		case "template":
+			areas = templateMatches(img, m.tmpl, m.threshold)
+		}
+		for _, a := range areas {
+			a = a.Inset(-m.pad).Intersect(img.Bounds())
+			if a.Empty() {
+				continue
+			}
+			draw.Draw(img, a, m.fill, image.Point{}, draw.Src)
+			s := a.Sub(img.Bounds().Min).Add(origin)
+			hits = append(hits, maskHit{Kind: m.kind, Rect: screenRect{
+				X: int32(s.Min.X), Y: int32(s.Min.Y), W: int32(s.Dx()), H: int32(s.Dy()),
+			}})
+		}
+	}
+	return hits
+}
+
+// colorAreas returns the bounding boxes of the 4-connected areas of
+// pixels within tol of c that have at least minPixels pixels.
+func colorAreas(img *image.RGBA, c color.RGBA, tol, minPixels int) []image.Rectangle {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	near := func(v, want uint8) bool {
+		d := int(v) - int(want)
+		return d <= tol && d >= -tol
+	}
+	match := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			p := row[x*4:]
+			match[y*w+x] = near(p[0], c.R) && near(p[1], c.G) && near(p[2], c.B)
+		}
+	}
+
+	var areas []image.Rectangle
+	var stack []int
+	for start := range match {
+		if !match[start] {
+			continue
+		}
+		match[start] = false
+		stack = append(stack[:0], start)
+		n := 0
+		r := image.Rect(start%w, start/w, start%w+1, start/w+1)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			n++
+			x, y := i%w, i/w
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+			for _, j := range [4]int{i - 1, i + 1, i - w, i + w} {
+				if j < 0 || j >= len(match) || !match[j] {
+					continue
+				}
+				if (j == i-1 && x == 0) || (j == i+1 && x == w-1) {
+					continue
+				}
+				match[j] = false
+				stack = append(stack, j)
+			}
+		}
+		if n >= minPixels {
+			areas = append(areas, r.Add(b.Min))
+		}
+	}
+	return areas
+}
+
+// templateMatches finds non-overlapping places where tmpl appears in img
+// with at least the given similarity (1 - mean absolute luma difference).
+// The search runs on a 4x downscaled image first and only refines the
+// candidates at full resolution.
+func templateMatches(img *image.RGBA, tmpl *image.Gray, threshold float64) []image.Rectangle {
+	g := image.NewGray(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(g, g.Bounds(), img, img.Bounds().Min, draw.Src)
+	tw, th := tmpl.Bounds().Dx(), tmpl.Bounds().Dy()
+	if tw > g.Rect.Dx() || th > g.Rect.Dy() {
+		return nil
+	}
+
+	// A coarse template and where its first block starts in tmpl.
+	type coarseTmpl struct {
+		img    *image.Gray
+		dx, dy int
+	}
+	const scale = 4
+	coarse, step := g, 1
+	phases := []coarseTmpl{{tmpl, 0, 0}}
+	if tw >= 4*scale && th >= 4*scale {
+		// A match rarely sits on the 4x4 grid of the shrunk image, and a
+		// block half over the template and half over its surroundings
+		// matches nothing. So the template is shrunk once per grid
+		// phase, from its first whole block on.
+		coarse, step, phases = shrinkGray(g, scale), scale, phases[:0]
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				sub := tmpl.SubImage(image.Rect(dx, dy, tw, th).Add(tmpl.Rect.Min)).(*image.Gray)
+				phases = append(phases, coarseTmpl{shrinkGray(sub, scale), dx, dy})
+			}
+		}
+	}
+	// The coarse pass is looser: downscaling blurs edges.
+	coarseMin := threshold - 0.05
+
+	var found []image.Rectangle
+	for _, ph := range phases {
+		cw, ch := ph.img.Rect.Dx(), ph.img.Rect.Dy()
+		for y := 0; y+ch <= coarse.Rect.Dy(); y++ {
+			for x := 0; x+cw <= coarse.Rect.Dx(); x++ {
+				if similarity(coarse, ph.img, x, y, coarseMin) < coarseMin {
+					continue
+				}
+				// Refine around the candidate at full resolution.
+				cx, cy := x*step-ph.dx, y*step-ph.dy
+				best, bx, by := -1.0, 0, 0
+				for fy := cy - 1; fy <= cy+1; fy++ {
+					for fx := cx - 1; fx <= cx+1; fx++ {
+						if fx < 0 || fy < 0 || fx+tw > g.Rect.Dx() || fy+th > g.Rect.Dy() {
+							continue
+						}
+						if s := similarity(g, tmpl, fx, fy, threshold); s > best {
+							best, bx, by = s, fx, fy
+						}
+					}
+				}
+				if best < threshold {
+					continue
+				}
+				r := image.Rect(bx, by, bx+tw, by+th)
+				overlaps := false
+				for _, f := range found {
+					if f.Overlaps(r) {
+						overlaps = true
+						break
+					}
+				}
+				if !overlaps {
+					found = append(found, r)
+				}
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Min.Y != found[j].Min.Y {
+			return found[i].Min.Y < found[j].Min.Y
+		}
+		return found[i].Min.X < found[j].Min.X
+	})
+	for i := range found {
+		found[i] = found[i].Add(img.Bounds().Min)
+	}
+	return found
+}
+
+// similarity compares tmpl with g at (x, y). It gives up early once the
+// score cannot reach floor.
+func similarity(g, tmpl *image.Gray, x, y int, floor float64) float64 {
+	tw, th := tmpl.Rect.Dx(), tmpl.Rect.Dy()
+	budget := (1 - floor) * 255 * float64(tw*th)
+	diff := 0.0
+	for ty := 0; ty < th; ty++ {
+		gr := g.Pix[(y+ty)*g.Stride+x:]
+		tr := tmpl.Pix[ty*tmpl.Stride:]
+		for tx := 0; tx < tw; tx++ {
+			d := int(gr[tx]) - int(tr[tx])
+			if d < 0 {
+				d = -d
+			}
+			diff += float64(d)
+		}
+		if diff > budget {
+			return 0
+		}
+	}
+	return 1 - diff/(255*float64(tw*th))
+}
+
+// shrinkGray averages k x k blocks.
+func shrinkGray(g *image.Gray, k int) *image.Gray {
+	w, h := g.Rect.Dx()/k, g.Rect.Dy()/k
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum := 0
+			for dy := 0; dy < k; dy++ {
+				row := g.Pix[(y*k+dy)*g.Stride+x*k:]
+				for dx := 0; dx < k; dx++ {
+					sum += int(row[dx])
+				}
+			}
+			out.Pix[y*out.Stride+x] = uint8(sum / (k * k))
+		}
+	}
+	return out
+}
+
+// =========================
+// Audit log
+// =========================
+
+// auditMasks appends a line to %APPDATA%\OcrBoard\audit.log recording that
+// a capture was masked: when, for which profile, and the painted areas.
+// The image itself is never written. One-off captures (OCR, repeat, a
+// finished scroll) are audited each time; watch and subtitle jobs, which
+// grab several times a second, only when the number of masked areas
+// changes (see regionSource).
+func auditMasks(profile string, rect screenRect, hits []maskHit) {
+	fmt.Printf("[OCR] Masked %d area(s) before upload (%s)\n", len(hits), profile)
+	entry := struct {
+		Time    time.Time  `json:"time"`
+		Event   string     `json:"event"`
+		Profile string     `json:"profile"`
+		Capture screenRect `json:"capture"`
+		Masks   []maskHit  `json:"masks"`
+	}{time.Now(), "mask", profile, rect, hits}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(configDir(), "audit.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		fmt.Printf("[OCR] Audit log: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Printf("[OCR] Audit log: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		fmt.Printf("[OCR] Audit log: %v\n", err)
+	}
+}
+
+// maskCapture applies the profile's masks to a crop whose top-left pixel
+// is at (l, t) in virtual-screen coordinates.
+func (p *profile) maskCapture(img *image.RGBA, l, t int32) []maskHit {
+	if len(p.masks) == 0 || img == nil {
+		return nil
+	}
+	return applyMasks(p.masks, img, image.Pt(int(l), int(t)))
+}
+
+// maskScroll masks the frames of a scrolling capture of the region at
+// (l, t) and returns the stitched image. A rect mask belongs to a place on
+// the screen, which the content scrolls past, so it is painted on every
+// frame; like a sticky header it then stays put between frames and does
+// not upset the overlap matching. Colour and template masks follow the
+// content and run once on the stitched image, whose hits are reported
+// relative to the top of the first frame.
+func (p *profile) maskScroll(frames []*image.RGBA, l, t int32) (*image.RGBA, []maskHit, error) {
+	var fixed, content []*imageMask
+	for _, m := range p.masks {
+		if m.kind == "rect" {
+			fixed = append(fixed, m)
+		} else {
+			content = append(content, m)
+		}
+	}
+	origin := image.Pt(int(l), int(t))
+	var hits []maskHit
+	for i, fr := range frames {
+		// Every frame covers the same screen area: log its hits once.
+		if h := applyMasks(fixed, fr, origin); i == 0 {
+			hits = h
+		}
+	}
+	img, err := stitchFrames(frames)
+	if err != nil {
+		return nil, nil, err
+	}
+	return img, append(hits, applyMasks(content, img, origin)...), nil
+}
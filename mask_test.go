@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+)
+
+func TestApplyMasks(t *testing.T) {
+	blue := color.RGBA{0x58, 0x65, 0xF2, 0xFF}
+	// A round avatar: a dark disc with a light edge on grey.
+	avatar := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			v := uint8(0x90)
+			if d := (x-8)*(x-8) + (y-8)*(y-8); d < 36 {
+				v = uint8(0x20 + d*4)
+			}
+			avatar.SetRGBA(x, y, color.RGBA{v, v, v, 0xFF})
+		}
+	}
+	tmpl := image.NewGray(avatar.Bounds())
+	draw.Draw(tmpl, tmpl.Bounds(), avatar, image.Point{}, draw.Src)
+
+	tests := []struct {
+		name  string
+		mask  imageMask
+		paint func(img *image.RGBA)
+		want  []maskHit
+	}{
+		{
+			"rect in screen coordinates",
+			imageMask{kind: "rect", rect: image.Rect(1000, 500, 1020, 510)},
+			nil,
+			[]maskHit{{"rect", screenRect{X: 1000, Y: 500, W: 20, H: 10}}},
+		},
+		{
+			"colour area with pad",
+			imageMask{kind: "color", color: blue, tolerance: 12, minPixels: 50, pad: 2},
+			func(img *image.RGBA) {
+				draw.Draw(img, image.Rect(10, 10, 20, 20), image.NewUniform(color.RGBA{0x5A, 0x60, 0xF0, 0xFF}), image.Point{}, draw.Src)
+				draw.Draw(img, image.Rect(40, 40, 43, 43), image.NewUniform(blue), image.Point{}, draw.Src) // too small
+			},
+			[]maskHit{{"color", screenRect{X: 998, Y: 498, W: 14, H: 14}}},
+		},
+		{
+			"template",
+			imageMask{kind: "template", tmpl: tmpl, threshold: 0.95},
+			func(img *image.RGBA) { draw.Draw(img, image.Rect(30, 5, 46, 21), avatar, image.Point{}, draw.Src) },
+			[]maskHit{{"template", screenRect{X: 1020, Y: 495, W: 16, H: 16}}},
+		},
+		{
+			"template twice, off the 4x4 grid",
+			imageMask{kind: "template", tmpl: tmpl, threshold: 0.95},
+			func(img *image.RGBA) {
+				draw.Draw(img, image.Rect(1, 2, 17, 18), avatar, image.Point{}, draw.Src)
+				draw.Draw(img, image.Rect(43, 41, 59, 57), avatar, image.Point{}, draw.Src)
+			},
+			[]maskHit{{"template", screenRect{X: 991, Y: 492, W: 16, H: 16}}, {"template", screenRect{X: 1033, Y: 531, W: 16, H: 16}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+			draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+			if tt.paint != nil {
+				tt.paint(img)
+			}
+			m := tt.mask
+			m.fill = image.NewUniform(color.RGBA{A: 0xFF})
+			hits := applyMasks([]*imageMask{&m}, img, image.Pt(990, 490))
+			if !reflect.DeepEqual(hits, tt.want) {
+				t.Fatalf("hits %v, want %v", hits, tt.want)
+			}
+			for _, h := range hits {
+				p := image.Pt(int(h.Rect.X)-990, int(h.Rect.Y)-490)
+				if c := img.RGBAAt(p.X, p.Y); c != (color.RGBA{A: 0xFF}) {
+					t.Errorf("hit %v not painted: %v", h.Rect, c)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskScroll(t *testing.T) {
+	const w, h = 256, 160
+	doc := scrollDoc(w, 1000, 5)
+	frames := scrollFrames(doc, nil, nil, h, []int{0, 40, 80, 120})
+	p := &profile{Name: "test"}
+	var err error
+	p.masks, err = compileMasks([]maskConfig{{Rect: &screenRect{X: 100, Y: 200, W: 32, H: h}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, hits, err := p.maskScroll(frames, 100, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dy() != 120+h {
+		t.Fatalf("height %d, want %d", img.Bounds().Dy(), 120+h)
+	}
+	want := []maskHit{{"rect", screenRect{X: 100, Y: 200, W: 32, H: h}}}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("hits %v, want %v", hits, want)
+	}
+	// The masked column runs the whole height; the rest is the page.
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		if c := img.RGBAAt(31, y); c != (color.RGBA{A: 0xFF}) {
+			t.Fatalf("row %d: masked column shows %v", y, c)
+		}
+		if img.RGBAAt(32, y) != doc.RGBAAt(32, y) {
+			t.Fatalf("row %d differs from the page", y)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// =========================
+// OCR result
+// =========================
+
+// ocrBox is one recognized line (or word) in image pixels, top-left origin.
+type ocrBox struct {
+	Text string  `json:"text"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	W    float64 `json:"w"`
+	H    float64 `json:"h"`
+	Conf float64 `json:"conf,omitempty"` // 0-100, if the backend reports it
+}
+
+type ocrResult struct {
+	Text    string
+	Boxes   []ocrBox
+	Backend string
+	Latency time.Duration
+	Tokens  tokenUsage // zero unless the backend is a language model
+	// Redacted is set when a redaction rule masked or dropped text, so the
+	// captured image still shows something the text no longer does.
+	Redacted bool
+}
+
+// tokenUsage is what a model backend billed for a result.
+type tokenUsage struct {
+	Prompt     int `json:"prompt"`
+	Completion int `json:"completion"`
+	Total      int `json:"total"`
+}
+
+func (u tokenUsage) add(v tokenUsage) tokenUsage {
+	return tokenUsage{u.Prompt + v.Prompt, u.Completion + v.Completion, u.Total + v.Total}
+}
+
+// =========================
+// HTTP
+// =========================
+
+func postPNGAndGetOCR(ctx context.Context, url string, auth *httpAuth, timeout time.Duration, pngBytes []byte) (*ocrResult, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	fw, err := w.CreateFormFile("file", "capture.png")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(fw, bytes.NewReader(pngBytes)); err != nil {
+		return nil, err
+	}
+	_ = w.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	if err := auth.apply(req); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		fmt.Printf("[OCR] API returned: error (%.3fs)\n", elapsed.Seconds())
+		return nil, auth.scrubErr(err)
+	}
+	defer resp.Body.Close()
+
+	fmt.Printf("[OCR] API returned: %d (%.3fs)\n", resp.StatusCode, elapsed.Seconds())
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 800))
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, auth.scrub(string(b)))
+	}
+
+	var out map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	res := &ocrResult{Backend: redactURL(url, auth), Latency: elapsed}
+	if err := json.Unmarshal(out["ocr_result"], &res.Text); err != nil {
+		return nil, fmt.Errorf("no ocr_result in response")
+	}
+	// Boxes are optional (macocr / iOS-OCR-Server send "ocr_boxes").
+	if raw, ok := out["ocr_boxes"]; ok {
+		_ = json.Unmarshal(raw, &res.Boxes)
+	}
+	return res, nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// =========================
+// Backend pool
+// =========================
+
+// ocrBackend turns one PNG into text. Backends are safe for concurrent use.
+type ocrBackend interface {
+	recognize(ctx context.Context, pngBytes []byte) (*ocrResult, error)
+	String() string
+}
+
+// serverBackend is a macocr / iOS-OCR-Server upload endpoint.
+type serverBackend struct {
+	url     string
+	auth    *httpAuth
+	timeout time.Duration
+}
+
+// String hides the secrets a URL may carry.
+func (b serverBackend) String() string { return redactURL(b.url, b.auth) }
+
+func (b serverBackend) recognize(ctx context.Context, pngBytes []byte) (*ocrResult, error) {
+	return postPNGAndGetOCR(ctx, b.url, b.auth, b.timeout, pngBytes)
+}
+
+// backendPool spreads requests round-robin over one or more backends and
+// caps how many are in flight at once.
+type backendPool struct {
+	backends []ocrBackend
+	next     atomic.Uint32
+	sem      chan struct{}
+}
+
+func newBackendPool(backends []ocrBackend, workers int) *backendPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &backendPool{backends: backends, sem: make(chan struct{}, workers)}
+}
+
+// serverBackends wraps server URLs as backends sharing auth and timeout.
+func serverBackends(urls []string, auth *httpAuth, timeout time.Duration) []ocrBackend {
+	out := make([]ocrBackend, len(urls))
+	for i, u := range urls {
+		out[i] = serverBackend{url: u, auth: auth, timeout: timeout}
+	}
+	return out
+}
+
+// parseURLList splits a comma-separated -url value.
+func parseURLList(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func (p *backendPool) String() string {
+	names := make([]string, len(p.backends))
+	for i, b := range p.backends {
+		names[i] = b.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p *backendPool) recognize(ctx context.Context, pngBytes []byte) (*ocrResult, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	b := p.backends[int(p.next.Add(1)-1)%len(p.backends)]
+	return b.recognize(ctx, pngBytes)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// =========================
+// OpenAI-compatible vision backend
+// =========================
+
+// visionPrompts are the built-in prompts, by name.
+var visionPrompts = map[string]string{
+	"transcribe": "Transcribe all text in this image exactly as written, keeping line breaks. " +
+		"Output only the text, without comments or formatting.",
+	"markdown": "Transcribe this image as Markdown: keep headings, lists, emphasis and tables. " +
+		"Output only the Markdown.",
+	"table": "Transcribe the table in this image as a Markdown table, one row per line. " +
+		"Output only the table.",
+}
+
+// promptData is what prompt templates are executed against.
+type promptData struct {
+	Profile       string
+	Width, Height int
+}
+
+type openAIBackend struct {
+	url         string
+	model       string
+	system      *template.Template
+	prompt      *template.Template
+	temperature float64
+	maxTokens   int
+	profile     string
+	auth        *httpAuth
+	client      *http.Client
+}
+
+func newOpenAIBackend(c *backendConfig, profile string, auth *httpAuth) (*openAIBackend, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("openai backend needs a url (…/v1/chat/completions)")
+	}
+	if c.Model == "" {
+		return nil, fmt.Errorf("openai backend needs a model")
+	}
+	b := &openAIBackend{
+		url:       c.URL,
+		model:     c.Model,
+		maxTokens: c.MaxTokens,
+		profile:   profile,
+		auth:      auth,
+		client:    &http.Client{Timeout: c.timeout(120 * time.Second)},
+	}
+	if c.Temperature != nil {
+		b.temperature = *c.Temperature
+	}
+
+	prompt := c.Prompt
+	if prompt == "" {
+		prompt = "transcribe"
+	}
+	if p, ok := visionPrompts[prompt]; ok {
+		prompt = p
+	}
+	var err error
+	if b.prompt, err = parsePrompt("prompt", prompt); err != nil {
+		return nil, err
+	}
+	if c.System != "" {
+		if b.system, err = parsePrompt("system", c.System); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *openAIBackend) String() string { return b.model + " @ " + b.url }
+
+// Request and response shapes of /v1/chat/completions, as far as used.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"` // string or []chatPart
+}
+
+type chatPart struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content json.RawMessage `json:"content"` // string, or parts from some servers
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (b *openAIBackend) recognize(ctx context.Context, pngBytes []byte) (*ocrResult, error) {
+	data := promptData{Profile: b.profile}
+	if cfg, err := pngConfig(pngBytes); err == nil {
+		data.Width, data.Height = cfg.Width, cfg.Height
+	}
+	var msgs []chatMessage
+	if b.system != nil {
+		system, err := execPrompt(b.system, data)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, chatMessage{Role: "system", Content: system})
+	}
+	prompt, err := execPrompt(b.prompt, data)
+	if err != nil {
+		return nil, err
+	}
+	msgs = append(msgs, chatMessage{Role: "user", Content: []chatPart{
+		{Type: "text", Text: prompt},
+		{Type: "image_url", ImageURL: &chatImageURL{URL: "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngBytes)}},
+	}})
+
+	body, err := json.Marshal(chatRequest{
+		Model:       b.model,
+		Messages:    msgs,
+		Temperature: b.temperature,
+		MaxTokens:   b.maxTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", b.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if err := b.auth.apply(req); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := b.client.Do(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Printf("[OCR] %s returned: error (%.3fs)\n", b.model, elapsed.Seconds())
+		return nil, b.auth.scrubErr(err)
+	}
+	defer resp.Body.Close()
+	fmt.Printf("[OCR] %s returned: %d (%.3fs)\n", b.model, resp.StatusCode, elapsed.Seconds())
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 800))
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, b.auth.scrub(string(msg)))
+	}
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.Error != nil {
+		return nil, fmt.Errorf("%s: %s", b.model, b.auth.scrub(out.Error.Message))
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("%s: no choices in response", b.model)
+	}
+	var usage tokenUsage
+	if u := out.Usage; u != nil {
+		usage = tokenUsage{Prompt: u.PromptTokens, Completion: u.CompletionTokens, Total: u.TotalTokens}
+		fmt.Printf("[OCR] %s tokens: %d prompt + %d completion = %d\n", b.model, u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+	}
+	choice := out.Choices[0]
+	if choice.FinishReason == "length" {
+		fmt.Printf("[OCR] %s: answer cut off by max_tokens\n", b.model)
+	}
+	text, err := chatContent(choice.Message.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.model, err)
+	}
+	return &ocrResult{Text: unfence(text), Backend: b.String(), Latency: elapsed, Tokens: usage}, nil
+}
+
+func pngConfig(pngBytes []byte) (image.Config, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(pngBytes))
+	return cfg, err
+}
+
+// parsePrompt parses a prompt template and runs it once, so unknown fields
+// are reported when the config loads rather than at the first capture.
+func parsePrompt(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if _, err := execPrompt(t, promptData{Profile: "default", Width: 100, Height: 100}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func execPrompt(t *template.Template, data promptData) (string, error) {
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("%s template: %w", t.Name(), err)
+	}
+	return sb.String(), nil
+}
+
+// chatContent reads a message content that is either a string or a list
+// of text parts.
+func chatContent(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []chatPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("unexpected message content")
+	}
+	var sb strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String(), nil
+}
+
+// unfence strips the ``` fence models like to wrap their whole answer in.
+func unfence(s string) string {
+	t := strings.TrimSpace(s)
+	if !strings.HasPrefix(t, "```") || !strings.HasSuffix(t, "```") || strings.Count(t, "```") != 2 {
+		return s
+	}
+	t = strings.TrimSuffix(t, "```")
+	nl := strings.IndexByte(t, '\n')
+	if nl < 0 {
+		return s
+	}
+	return strings.TrimRight(t[nl+1:], "\n")
+}
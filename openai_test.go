@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	b, err := encodePNG(image.NewRGBA(image.Rect(0, 0, w, h)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOpenAIBackend(t *testing.T) {
+	var got chatRequest
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		var raw struct {
+			chatRequest
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Error(err)
+		}
+		got = raw.chatRequest
+		for _, m := range raw.Messages {
+			var parts []chatPart
+			if json.Unmarshal(m.Content, &parts) == nil {
+				got.Messages = append(got.Messages, chatMessage{Role: m.Role, Content: parts})
+			} else {
+				var s string
+				json.Unmarshal(m.Content, &s)
+				got.Messages = append(got.Messages, chatMessage{Role: m.Role, Content: s})
+			}
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"` + "```text\\nline 1\\nline 2\\n```" + `"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":812,"completion_tokens":41,"total_tokens":853}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("OCR_TEST_TOKEN", "sk-test-123")
+	c := &backendConfig{
+		Type: backendOpenAI, URL: srv.URL, Model: "vl-model",
+		System: "You read {{.Profile}} captures.", Prompt: "Read this {{.Width}}x{{.Height}} image.",
+		Auth: &authConfig{Type: authBearer, Token: "env:OCR_TEST_TOKEN"},
+	}
+	backends, err := newBackends(c, "docs", nil, newCredentialStore(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := backends[0].recognize(context.Background(), testPNG(t, 64, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Text != "line 1\nline 2" {
+		t.Errorf("text %q", res.Text)
+	}
+	if want := (tokenUsage{812, 41, 853}); res.Tokens != want {
+		t.Errorf("tokens %+v, want %+v", res.Tokens, want)
+	}
+	if gotAuth != "Bearer sk-test-123" {
+		t.Errorf("Authorization %q", gotAuth)
+	}
+	if got.Model != "vl-model" || len(got.Messages) != 2 {
+		t.Fatalf("request %+v", got)
+	}
+	if s := got.Messages[0].Content; s != "You read docs captures." {
+		t.Errorf("system %q", s)
+	}
+	parts := got.Messages[1].Content.([]chatPart)
+	if parts[0].Text != "Read this 64x32 image." {
+		t.Errorf("prompt %q", parts[0].Text)
+	}
+	if !strings.HasPrefix(parts[1].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("image part %.40q", parts[1].ImageURL.URL)
+	}
+}
+
+func TestOpenAIBackendErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"http error scrubbed", 401, `{"error":{"message":"bad key sk-test-123"}}`, "HTTP 401: {\"error\":{\"message\":\"bad key [REDACTED]\"}}"},
+		{"error field", 200, `{"error":{"message":"model overloaded"}}`, "vl-model: model overloaded"},
+		{"no choices", 200, `{"choices":[]}`, "vl-model: no choices in response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			auth, _ := newHTTPAuth(&authConfig{Type: authBearer, Token: "sk-test-123"}, nil, nil)
+			b, err := newOpenAIBackend(&backendConfig{URL: srv.URL, Model: "vl-model"}, "default", auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = b.recognize(context.Background(), testPNG(t, 8, 8))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOpenAIBackendConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		c    backendConfig
+		err  string // substring; empty means valid
+	}{
+		{"built-in prompt", backendConfig{URL: "http://x", Model: "m", Prompt: "markdown"}, ""},
+		{"no model", backendConfig{URL: "http://x"}, "needs a model"},
+		{"bad syntax", backendConfig{URL: "http://x", Model: "m", Prompt: "{{.Width"}, "prompt"},
+		{"unknown field", backendConfig{URL: "http://x", Model: "m", Prompt: "{{.Language}}"}, "can't evaluate field Language"},
+		{"unknown system field", backendConfig{URL: "http://x", Model: "m", System: "{{.Lang}}"}, "system"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newOpenAIBackend(&tt.c, "default", nil)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUnfence(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"```\ncode\n```", "code"},
+		{"```markdown\n# Title\n```\n", "# Title"},
+		{"plain", "plain"},
+		{"```a``` and ```b```", "```a``` and ```b```"},
+	}
+	for _, tt := range tests {
+		if got := unfence(tt.in); got != tt.want {
+			t.Errorf("unfence(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// =========================
+// Reading order
+// =========================
+
+// Reading orders for profile.Order.
+const (
+	orderBackend  = ""         // keep the backend's text
+	orderAuto     = "auto"     // detect vertical writing and columns
+	orderRows     = "rows"     // top to bottom, left to right
+	orderColumns  = "columns"  // column by column, then rows
+	orderVertical = "vertical" // vertical lines right to left, each top to bottom
+)
+
+func checkOrder(mode string) error {
+	switch mode {
+	case orderBackend, orderAuto, orderRows, orderColumns, orderVertical:
+		return nil
+	}
+	return fmt.Errorf("reading_order %q: want auto, rows, columns or vertical", mode)
+}
+
+// applyOrder rebuilds the text of res from its boxes in reading order.
+// Results without boxes are left alone.
+func applyOrder(mode string, res *ocrResult) {
+	if mode == orderBackend || len(res.Boxes) == 0 {
+		return
+	}
+	vertical := mode == orderVertical || (mode == orderAuto && isVertical(res.Boxes))
+	if vertical {
+		res.Text = orderText(transpose(res.Boxes), false, true)
+		return
+	}
+	if mode == orderRows {
+		res.Text = joinRows(groupRows(res.Boxes), false)
+		return
+	}
+	res.Text = orderText(res.Boxes, mode == orderColumns, false)
+}
+
+// isVertical reports whether most boxes of two or more characters are
+// tall and narrow, i.e. vertical lines.
+func isVertical(boxes []ocrBox) bool {
+	tall, n := 0, 0
+	for _, b := range boxes {
+		if utf8.RuneCountInString(strings.TrimSpace(b.Text)) < 2 {
+			continue
+		}
+		n++
+		if b.H > 1.5*b.W {
+			tall++
+		}
+	}
+	return n > 0 && tall*2 > n
+}
+
+// transpose turns vertical right-to-left text into horizontal text: a
+// vertical line becomes a row read left to right, the rightmost line the
+// top row, so the row and column logic below applies unchanged.
+func transpose(boxes []ocrBox) []ocrBox {
+	out := make([]ocrBox, len(boxes))
+	for i, b := range boxes {
+		out[i] = ocrBox{Text: b.Text, X: b.Y, Y: -(b.X + b.W), W: b.H, H: b.W, Conf: b.Conf}
+	}
+	return out
+}
+
+// orderText reads multi-column layouts column by column. Columns are split
+// at gutters running the full height; a box crossing a gutter (a headline
+// over both columns) ends the band above it, so the page reads band by
+// band. Unless forced, a split is only kept when every column is wide and
+// several lines long, so forms and label/value lists stay row by row.
+func orderText(boxes []ocrBox, force, cjk bool) string {
+	rows := groupRows(boxes)
+	if len(rows) == 0 {
+		return ""
+	}
+	var heights []float64
+	for _, r := range rows {
+		heights = append(heights, r.bottom-r.top)
+	}
+	h := median(heights)
+
+	// Boxes wider than most of the page are headlines or single-column
+	// text; they would close every gutter, so only narrower boxes count.
+	left, right := math.Inf(1), math.Inf(-1)
+	for _, b := range boxes {
+		left = math.Min(left, b.X)
+		right = math.Max(right, b.X+b.W)
+	}
+	var narrow []ocrBox
+	for _, b := range boxes {
+		if b.W <= 0.6*(right-left) {
+			narrow = append(narrow, b)
+		}
+	}
+	bounds := gutters(narrow, len(rows)/20, math.Max(1.5*h, 1))
+
+	// Split into spanning boxes and per-column boxes.
+	crosses := func(b ocrBox) bool {
+		for _, x := range bounds {
+			if b.X < x && b.X+b.W > x {
+				return true
+			}
+		}
+		return false
+	}
+	var spans []ocrBox
+	cols := make([][]ocrBox, len(bounds)+1)
+	for _, b := range boxes {
+		if crosses(b) {
+			spans = append(spans, b)
+			continue
+		}
+		c := sort.SearchFloat64s(bounds, b.X+b.W/2)
+		cols[c] = append(cols[c], b)
+	}
+	if len(bounds) == 0 || (!force && !realColumns(cols, h)) {
+		return joinRows(rows, cjk)
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Y < spans[j].Y })
+	// band returns how many spanning boxes lie above b.
+	band := func(b ocrBox) int {
+		cy := b.Y + b.H/2
+		return sort.Search(len(spans), func(i int) bool { return spans[i].Y+spans[i].H/2 > cy })
+	}
+
+	var lines []string
+	for bi := 0; bi <= len(spans); bi++ {
+		for _, col := range cols {
+			var in []ocrBox
+			for _, b := range col {
+				if band(b) == bi {
+					in = append(in, b)
+				}
+			}
+			if t := joinRows(groupRows(in), cjk); t != "" {
+				lines = append(lines, t)
+			}
+		}
+		if bi < len(spans) {
+			lines = append(lines, strings.TrimSpace(spans[bi].Text))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// realColumns reports whether every column looks like running text: at
+// least three lines and as wide as about eight line heights.
+func realColumns(cols [][]ocrBox, h float64) bool {
+	for _, col := range cols {
+		if len(groupRows(col)) < 3 {
+			return false
+		}
+		left, right := math.Inf(1), math.Inf(-1)
+		for _, b := range col {
+			left = math.Min(left, b.X)
+			right = math.Max(right, b.X+b.W)
+		}
+		if right-left < 8*h {
+			return false
+		}
+	}
+	return true
+}
+
+// joinRows writes one line per row. Boxes within a row are separated by a
+// space, except between CJK characters, or always joined directly for
+// vertical text, whose boxes are pieces of one line.
+func joinRows(rows []*boxRow, cjk bool) string {
+	lines := make([]string, 0, len(rows))
+	for _, r := range rows {
+		var line strings.Builder
+		for _, b := range r.boxes {
+			t := strings.TrimSpace(b.Text)
+			if line.Len() > 0 && !cjk {
+				prev, _ := utf8.DecodeLastRuneInString(line.String())
+				next, _ := utf8.DecodeRuneInString(t)
+				if !isCJK(prev) || !isCJK(next) {
+					line.WriteByte(' ')
+				}
+			}
+			line.WriteString(t)
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
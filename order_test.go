@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// column lays out n lines of a text column at x, one every 30px from y.
+func column(prefix string, x, y, w float64, n int) []ocrBox {
+	var boxes []ocrBox
+	for i := range n {
+		boxes = append(boxes, ocrBox{Text: fmt.Sprintf("%s%d", prefix, i+1), X: x, Y: y + float64(i)*30, W: w, H: 20})
+	}
+	return boxes
+}
+
+func concat(parts ...[]ocrBox) []ocrBox {
+	var out []ocrBox
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestApplyOrder(t *testing.T) {
+	twoCols := concat(column("R", 400, 0, 300, 5), column("L", 0, 0, 300, 5)) // backend order: right column first
+	form := []ocrBox{
+		{Text: "Name:", X: 0, Y: 0, W: 60, H: 20}, {Text: "Alice", X: 200, Y: 0, W: 80, H: 20},
+		{Text: "City:", X: 0, Y: 30, W: 50, H: 20}, {Text: "Taipei", X: 200, Y: 30, W: 90, H: 20},
+		{Text: "Phone:", X: 0, Y: 60, W: 70, H: 20}, {Text: "none", X: 200, Y: 60, W: 60, H: 20},
+		{Text: "Email:", X: 0, Y: 90, W: 70, H: 20}, {Text: "a@b.c", X: 200, Y: 90, W: 80, H: 20},
+	}
+	vertical := []ocrBox{ // right to left, each line top to bottom; the middle line in two pieces
+		{Text: "七八九", X: 140, Y: 0, W: 24, H: 72},
+		{Text: "一二三", X: 200, Y: 0, W: 24, H: 72},
+		{Text: "六", X: 170, Y: 50, W: 24, H: 24},
+		{Text: "四五", X: 170, Y: 0, W: 24, H: 48},
+	}
+
+	tests := []struct {
+		name  string
+		mode  string
+		boxes []ocrBox
+		want  string
+	}{
+		{"vertical right to left", orderAuto, vertical, "一二三\n四五六\n七八九"},
+		{"vertical forced", orderVertical, vertical, "一二三\n四五六\n七八九"},
+		{"two columns", orderAuto, twoCols, "L1\nL2\nL3\nL4\nL5\nR1\nR2\nR3\nR4\nR5"},
+		{"two columns as rows", orderRows, twoCols, "L1 R1\nL2 R2\nL3 R3\nL4 R4\nL5 R5"},
+		{"headline over both columns", orderAuto,
+			concat([]ocrBox{{Text: "Headline", X: 0, Y: 0, W: 700, H: 30}}, column("R", 400, 50, 300, 4), column("L", 0, 50, 300, 4)),
+			"Headline\nL1\nL2\nL3\nL4\nR1\nR2\nR3\nR4"},
+		{"headline between bands", orderAuto,
+			concat(column("a", 0, 0, 300, 3), column("b", 400, 0, 300, 3),
+				[]ocrBox{{Text: "Section 2", X: 50, Y: 100, W: 600, H: 20}},
+				column("c", 0, 140, 300, 3), column("d", 400, 140, 300, 3)),
+			"a1\na2\na3\nb1\nb2\nb3\nSection 2\nc1\nc2\nc3\nd1\nd2\nd3"},
+		{"form row by row", orderAuto, form, "Name: Alice\nCity: Taipei\nPhone: none\nEmail: a@b.c"},
+		{"form forced into columns", orderColumns, form, "Name:\nCity:\nPhone:\nEmail:\nAlice\nTaipei\nnone\na@b.c"},
+		{"CJK boxes joined without spaces", orderAuto,
+			[]ocrBox{{Text: "中文", X: 0, Y: 0, W: 40, H: 20}, {Text: "識別", X: 45, Y: 0, W: 40, H: 20}, {Text: "OK", X: 90, Y: 0, W: 30, H: 20}},
+			"中文識別 OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &ocrResult{Text: "backend text", Boxes: tt.boxes}
+			applyOrder(tt.mode, res)
+			if res.Text != tt.want {
+				t.Errorf("got %q\nwant %q", res.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrderKeepsBackendText(t *testing.T) {
+	off := &ocrResult{Text: "as read", Boxes: column("x", 0, 0, 100, 2)}
+	applyOrder(orderBackend, off)
+	noBoxes := &ocrResult{Text: "as read"}
+	applyOrder(orderAuto, noBoxes)
+	if off.Text != "as read" || noBoxes.Text != "as read" {
+		t.Errorf("texts = %q, %q", off.Text, noBoxes.Text)
+	}
+}
+
+func TestIsVertical(t *testing.T) {
+	tests := []struct {
+		name  string
+		boxes []ocrBox
+		want  bool
+	}{
+		{"horizontal lines", column("line", 0, 0, 300, 3), false},
+		{"tall lines", []ocrBox{{Text: "縦書き", W: 20, H: 60}, {Text: "です", X: 30, W: 20, H: 40}}, true},
+		{"single characters ignored", []ocrBox{{Text: "一", W: 10, H: 40}, {Text: "二", W: 10, H: 40}, {Text: "wide text", W: 100, H: 20}}, false},
+		{"no text", []ocrBox{{Text: " ", W: 10, H: 40}}, false},
+	}
+	for _, tt := range tests {
+		if got := isVertical(tt.boxes); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOrder(t *testing.T) {
+	for _, mode := range []string{"", "auto", "rows", "columns", "vertical"} {
+		if err := checkOrder(mode); err != nil {
+			t.Errorf("%q: %v", mode, err)
+		}
+	}
+	if err := checkOrder("diagonal"); err == nil {
+		t.Error("diagonal accepted")
+	}
+}
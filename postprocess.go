@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// =========================
+// Text post-processing
+// =========================
+
+// postConfig toggles the clean-up steps run on OCR text before the sinks.
+// Steps run in field order; all are off by default.
+type postConfig struct {
+	Normalize      string     `json:"normalize,omitempty"`       // "NFC" or "NFKC"
+	Trim           bool       `json:"trim,omitempty"`            // trailing whitespace and blank edge lines
+	CollapseSpaces bool       `json:"collapse_spaces,omitempty"` // runs of spaces/tabs -> one space
+	Dehyphenate    bool       `json:"dehyphenate,omitempty"`     // "exam-\nple" -> "example"
+	Unwrap         bool       `json:"unwrap,omitempty"`          // join soft-wrapped lines into paragraphs
+	Convert        string     `json:"convert,omitempty"`         // OpenCC conversion, e.g. "s2twp"
+	CJK            *cjkConfig `json:"cjk,omitempty"`             // CJK spacing, width and punctuation rules
+}
+
+type textStep func(string) string
+
+func (c *postConfig) steps() ([]textStep, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var steps []textStep
+	switch strings.ToUpper(c.Normalize) {
+	case "":
+	case "NFC":
+		steps = append(steps, norm.NFC.String)
+	case "NFKC":
+		steps = append(steps, norm.NFKC.String)
+	default:
+		return nil, fmt.Errorf("normalize %q: want NFC or NFKC", c.Normalize)
+	}
+	if c.Trim {
+		steps = append(steps, trimText)
+	}
+	if c.CollapseSpaces {
+		steps = append(steps, collapseSpaces)
+	}
+	if c.Dehyphenate {
+		steps = append(steps, dehyphenate)
+	}
+	if c.Unwrap {
+		steps = append(steps, unwrapLines)
+	}
+	if c.Convert != "" {
+		step, err := zhStep(c.Convert)
+		if err != nil {
+			return nil, fmt.Errorf("convert: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	cjk, err := c.CJK.steps()
+	if err != nil {
+		return nil, fmt.Errorf("cjk: %w", err)
+	}
+	return append(steps, cjk...), nil
+}
+
+func runSteps(steps []textStep, s string) string {
+	for _, step := range steps {
+		s = step(s)
+	}
+	return s
+}
+
+// trimText removes trailing whitespace from every line and drops blank
+// lines at the start and end.
+func trimText(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseSpaces folds runs of spaces, tabs and no-break spaces inside a
+// line into one space. Leading indentation is kept.
+func collapseSpaces(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		body := strings.TrimLeft(l, " \t")
+		indent := l[:len(l)-len(body)]
+
+		var b strings.Builder
+		b.WriteString(indent)
+		space := false
+		for _, r := range body {
+			if r == ' ' || r == '\t' || r == '\u00a0' {
+				space = true
+				continue
+			}
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+		if space {
+			b.WriteByte(' ')
+		}
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// dehyphenate rejoins a word split across lines with a hyphen: the word's
+// tail moves up to the previous line. Only letter-hyphen / lowercase
+// continuations count, so "pre-\nWar" and "-- \n" are left alone.
+func dehyphenate(s string) string {
+	lines := strings.Split(s, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		cur := strings.TrimRight(lines[i], " \t")
+		next := strings.TrimLeft(lines[i+1], " \t")
+		if !strings.HasSuffix(cur, "-") || strings.HasSuffix(cur, "--") {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(cur[:len(cur)-1])
+		after, _ := utf8.DecodeRuneInString(next)
+		if !unicode.IsLetter(before) || !unicode.IsLower(after) {
+			continue
+		}
+		word, rest, _ := strings.Cut(next, " ")
+		lines[i] = cur[:len(cur)-1] + word
+		if rest = strings.TrimLeft(rest, " "); rest != "" {
+			lines[i+1] = rest
+			continue
+		}
+		// The continuation was the whole line: drop it rather than leave a
+		// blank line that reads as a paragraph break, and look at the
+		// joined line again in case it ends in a hyphen too.
+		lines = append(lines[:i+1], lines[i+2:]...)
+		i--
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unwrapLines joins the visual lines of each paragraph. A line ends its
+// paragraph when it is followed by a blank line or a list item, or when it
+// is clearly shorter than the text column (a last line or a heading).
+// CJK text is joined without a space.
+func unwrapLines(s string) string {
+	lines := strings.Split(s, "\n")
+	width := 0
+	for _, l := range lines {
+		width = max(width, utf8.RuneCountInString(strings.TrimSpace(l)))
+	}
+
+	var out []string
+	var para strings.Builder
+	flush := func() {
+		if para.Len() > 0 {
+			out = append(out, para.String())
+			para.Reset()
+		}
+	}
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			flush()
+			out = append(out, "")
+			continue
+		}
+		if para.Len() > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(para.String())
+			next, _ := utf8.DecodeRuneInString(l)
+			if !isCJK(prev) && !isCJK(next) && prev != '-' {
+				para.WriteByte(' ')
+			}
+		}
+		para.WriteString(l)
+
+		hard := i+1 >= len(lines) ||
+			strings.TrimSpace(lines[i+1]) == "" ||
+			isListItem(strings.TrimSpace(lines[i+1])) ||
+			utf8.RuneCountInString(l)*10 < width*7 ||
+			(endsSentence(l) && utf8.RuneCountInString(l)*10 < width*9)
+		if hard {
+			flush()
+		}
+	}
+	flush()
+
+	// Collapse the blank lines kept above into single paragraph breaks.
+	var res []string
+	for i, l := range out {
+		if l == "" && (i == 0 || out[i-1] == "") {
+			continue
+		}
+		res = append(res, l)
+	}
+	return strings.TrimRight(strings.Join(res, "\n"), "\n")
+}
+
+func endsSentence(l string) bool {
+	r, _ := utf8.DecodeLastRuneInString(l)
+	return strings.ContainsRune(".!?:;。！？：；」』”\"", r)
+}
+
+func isListItem(l string) bool {
+	r, size := utf8.DecodeRuneInString(l)
+	if strings.ContainsRune("-*•·‧●○▪–", r) {
+		return len(l) > size && (l[size] == ' ' || r > 0x7f)
+	}
+	// "1. " / "12) "
+	i := 0
+	for i < len(l) && l[i] >= '0' && l[i] <= '9' {
+		i++
+	}
+	return i > 0 && i+1 < len(l) && (l[i] == '.' || l[i] == ')') && l[i+1] == ' '
+}
+
+// isCJK reports Han, Kana, Hangul and CJK/full-width punctuation.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || // CJK symbols and punctuation
+		(r >= 0xFF00 && r <= 0xFFEF) // half/full-width forms
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestDehyphenate(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"split word", "the exam-\nple shows", "the example\nshows"},
+		{"whole continuation line", "exam-\nple\nfoo bar", "example\nfoo bar"},
+		{"last line", "an exam-\nple", "an example"},
+		{"split twice", "co-\nop-\neration is key", "cooperation\nis key"},
+		{"paragraph break kept", "exam-\nple\n\nNext", "example\n\nNext"},
+		{"indented continuation", "inter-\n   national trade", "international\ntrade"},
+		{"capital continuation", "pre-\nWar era", "pre-\nWar era"},
+		{"dash", "wait --\nnow", "wait --\nnow"},
+		{"number", "pages 10-\n12 only", "pages 10-\n12 only"},
+		{"trailing space", "exam- \nple text", "example\ntext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dehyphenate(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapLines(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"paragraphs",
+			"Optical character recognition turns images of\n" +
+				"typed or printed text into machine-encoded text\n" +
+				"that can be searched and edited.\n" +
+				"\n" +
+				"It is widely used for scanned documents, receipts\n" +
+				"and screenshots of chat windows.",
+			"Optical character recognition turns images of typed or printed text into machine-encoded text that can be searched and edited.\n" +
+				"\n" +
+				"It is widely used for scanned documents, receipts and screenshots of chat windows.",
+		},
+		{
+			"heading and list",
+			"Installation\n" +
+				"Download the release archive and unpack it into\n" +
+				"a folder of your choice, then run the binary.\n" +
+				"- Windows 10 or later\n" +
+				"- a reachable OCR server",
+			"Installation\n" +
+				"Download the release archive and unpack it into a folder of your choice, then run the binary.\n" +
+				"- Windows 10 or later\n" +
+				"- a reachable OCR server",
+		},
+		{
+			"numbered list",
+			"1. Select a region with the mouse\n2) Wait for the\nresult",
+			"1. Select a region with the mouse\n2) Wait for the\nresult",
+		},
+		{
+			"cjk joined without spaces",
+			"光學字元辨識是把影像中的文字\n轉成可編輯文字的技術。\n\n第二段。",
+			"光學字元辨識是把影像中的文字轉成可編輯文字的技術。\n\n第二段。",
+		},
+		{
+			"blank lines collapsed",
+			"\n\nfirst paragraph\n\n\n\nsecond paragraph\n\n",
+			"first paragraph\n\nsecond paragraph",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unwrapLines(tt.in); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostSteps(t *testing.T) {
+	c := &postConfig{Normalize: "NFKC", Trim: true, CollapseSpaces: true, Dehyphenate: true, Unwrap: true}
+	steps, err := c.steps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "  \nＯＣＲ  output   from a scanned page of a book, with hyphen-\n" +
+		"ated words and   wrapped lines, comes out as one para-\n" +
+		"graph of plain text.  \n\n"
+	want := "OCR output from a scanned page of a book, with hyphenated words and wrapped lines, comes out as one paragraph of plain text."
+	if got := runSteps(steps, in); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := (&postConfig{Normalize: "NFD"}).steps(); err == nil {
+		t.Error("NFD accepted")
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// =========================
+// Redaction
+// =========================
+
+// Redaction actions.
+const (
+	redactMask = "mask" // replace the match with [REDACTED name]
+	redactDrop = "drop" // remove every line containing a match
+	redactWarn = "warn" // keep the text, only log the hit
+	redactOff  = "off"  // disable (built-in rules)
+)
+
+// redactConfig is the per-profile "redact" section. Built-in detectors
+// run with Action (default mask; "off" disables them). A rule without a
+// pattern changes the action of the built-in of that name; a rule with a
+// pattern adds a detector.
+type redactConfig struct {
+	Action string       `json:"action,omitempty"`
+	Rules  []redactRule `json:"rules,omitempty"`
+}
+
+type redactRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern,omitempty"` // Go regexp
+	Action  string `json:"action,omitempty"`  // default: mask
+}
+
+type detector struct {
+	name   string
+	re     *regexp.Regexp
+	check  func(string) bool // extra validation of a match, may be nil
+	alone  bool              // the match must not be glued to the text around it
+	action string
+}
+
+// builtinDetectors in the order they run: specific token formats before
+// the generic shapes that would also match them.
+var builtinDetectors = []detector{
+	{name: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`)},
+	{name: "aws_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{name: "github_token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{name: "token", re: regexp.MustCompile(`\b(?:xox[baprs]-[A-Za-z0-9-]{10,}|sk-[A-Za-z0-9_-]{20,}|AIza[0-9A-Za-z_-]{35}|eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,})`)},
+	{name: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{name: "card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), check: luhnValid},
+	{name: "iban", re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`), check: ibanValid},
+	// A phone number has a + prefix, an area code in brackets or two
+	// separators; bare digit runs are order numbers, IDs and amounts.
+	{name: "phone", re: regexp.MustCompile(`\+\d{1,3}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}[ .-]?\d{3,4}[ .-]?\d{3,4}\b|` +
+		`\(\d{1,4}\)[ .-]?\d{3,4}[ .-]?\d{3,4}\b|` +
+		`\d{2,4}[ .-]\d{3,4}[ .-]\d{3,4}\b`), check: phoneValid, alone: true},
+	{name: "entropy", re: regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`), check: highEntropy},
+}
+
+func checkRedactAction(a string, builtin bool) error {
+	switch a {
+	case redactMask, redactDrop, redactWarn:
+		return nil
+	case redactOff:
+		if builtin {
+			return nil
+		}
+	}
+	return fmt.Errorf("action %q: want mask, drop or warn", a)
+}
+
+// redactor applies the compiled rules of one profile.
+type redactor struct {
+	profile   string
+	detectors []detector
+}
+
+func (c *redactConfig) compile(profile string) (*redactor, error) {
+	if c == nil {
+		return nil, nil
+	}
+	def := c.Action
+	if def == "" {
+		def = redactMask
+	}
+	if err := checkRedactAction(def, true); err != nil {
+		return nil, err
+	}
+
+	r := &redactor{profile: profile}
+	builtins := make(map[string]string)
+	var custom []detector
+	for _, rule := range c.Rules {
+		action := rule.Action
+		if action == "" {
+			action = redactMask
+		}
+		if rule.Pattern == "" {
+			if !isBuiltinDetector(rule.Name) {
+				return nil, fmt.Errorf("rule %q: no pattern and no built-in of that name", rule.Name)
+			}
+			if err := checkRedactAction(action, true); err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			builtins[rule.Name] = action
+			continue
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %q: missing name", rule.Pattern)
+		}
+		if err := checkRedactAction(action, false); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		custom = append(custom, detector{name: rule.Name, re: re, action: action})
+	}
+
+	// User rules first: they are usually the more specific ones.
+	r.detectors = custom
+	for _, d := range builtinDetectors {
+		d.action = def
+		if a, ok := builtins[d.name]; ok {
+			d.action = a
+		}
+		if d.action != redactOff {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	return r, nil
+}
+
+func isBuiltinDetector(name string) bool {
+	for _, d := range builtinDetectors {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactText applies the detectors to s and returns the result and how
+// often each rule hit.
+func (r *redactor) redactText(s string) (string, map[string]int) {
+	hits := make(map[string]int)
+	drop := false
+	for _, d := range r.detectors {
+		var b strings.Builder
+		last := 0
+		for _, loc := range d.re.FindAllStringIndex(s, -1) {
+			m := s[loc[0]:loc[1]]
+			if d.check != nil && !d.check(m) || d.alone && !standsAlone(s, loc[0], loc[1]) {
+				continue
+			}
+			hits[d.name]++
+			switch d.action {
+			case redactMask:
+				m = "[REDACTED " + d.name + "]"
+			case redactDrop:
+				drop = true
+				m = "\x00" // marks the line for removal below
+			}
+			b.WriteString(s[last:loc[0]])
+			b.WriteString(m)
+			last = loc[1]
+		}
+		if last > 0 {
+			b.WriteString(s[last:])
+			s = b.String()
+		}
+	}
+	if drop {
+		lines := strings.Split(s, "\n")
+		kept := lines[:0]
+		for _, l := range lines {
+			if !strings.Contains(l, "\x00") {
+				kept = append(kept, l)
+			}
+		}
+		s = strings.Join(kept, "\n")
+	}
+	return s, hits
+}
+
+// apply redacts the text and boxes of res, marks it Redacted when a mask
+// or drop rule hit and logs which rules hit. The log names the rule and
+// the count, never the matched text.
+func (r *redactor) apply(res *ocrResult) {
+	if r == nil {
+		return
+	}
+	text, hits := r.redactText(res.Text)
+	res.Text = text
+
+	kept := res.Boxes[:0]
+	for _, b := range res.Boxes {
+		t, boxHits := r.redactText(b.Text)
+		for n := range boxHits {
+			res.Redacted = res.Redacted || r.actionOf(n) != redactWarn
+		}
+		if strings.TrimSpace(t) == "" && strings.TrimSpace(b.Text) != "" {
+			continue // dropped
+		}
+		b.Text = t
+		kept = append(kept, b)
+	}
+	res.Boxes = kept
+
+	names := make([]string, 0, len(hits))
+	for n := range hits {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		res.Redacted = res.Redacted || r.actionOf(n) != redactWarn
+		fmt.Printf("[OCR] Redact (%s): rule %s matched %d time(s), %s\n", r.profile, n, hits[n], r.actionOf(n))
+	}
+}
+
+func (r *redactor) actionOf(name string) string {
+	for _, d := range r.detectors {
+		if d.name == name {
+			return d.action
+		}
+	}
+	return ""
+}
+
+// luhnValid reports whether the digits of s pass the Luhn check used by
+// payment card numbers.
+func luhnValid(s string) bool {
+	var digits []int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// ibanValid checks the ISO 13616 mod-97 checksum.
+func ibanValid(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	s = s[4:] + s[:4]
+	rem := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// phoneValid keeps matches with a plausible number of digits (9 to 15,
+// E.164) that are not dates like 2024-01-15 or dotted quads like IPv4
+// addresses.
+func phoneValid(s string) bool {
+	n := 0
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			n++
+		}
+	}
+	if n < 9 || n > 15 {
+		return false
+	}
+	return !dateLike.MatchString(s) && !dottedQuad.MatchString(s)
+}
+
+var (
+	dateLike   = regexp.MustCompile(`^\d{4}[-./]\d{2}[-./]\d{2}`)
+	dottedQuad = regexp.MustCompile(`^\d{1,3}(?:\.\d{1,3}){2,3}$`)
+)
+
+// highEntropy flags long strings whose Shannon entropy is that of random
+// keys rather than words or identifiers. Letters and digits must be mixed
+// all through the string, not just present: an identifier such as
+// "ConfigManager2024" changes case or class only between its words, a
+// random key at every other character. Anything with a path separator is
+// a path, not a key.
+func highEntropy(s string) bool {
+	if strings.ContainsAny(s, `/\`) {
+		return false
+	}
+	class := func(r rune) int {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 1
+		case r >= 'A' && r <= 'Z':
+			return 2
+		case r >= '0' && r <= '9':
+			return 3
+		}
+		return 0
+	}
+	var seen [4]bool
+	changes := 0
+	counts := make(map[rune]int)
+	prev := -1
+	for _, r := range s {
+		counts[r]++
+		c := class(r)
+		seen[c] = true
+		if prev >= 0 && c != prev {
+			changes++
+		}
+		prev = c
+	}
+	if !seen[3] || !(seen[1] || seen[2]) || changes*3 < len(s)-1 {
+		return false
+	}
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(len(s))
+		h -= p * math.Log2(p)
+	}
+	return h >= 4.0
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// =========================
+// Output sinks
+// =========================
+
+// ocrOutput is one finished OCR result on its way to the sinks. It is
+// also the data sink templates are executed against.
+type ocrOutput struct {
+	Text    string
+	Boxes   []ocrBox
+	Time    time.Time
+	Backend string
+	Latency time.Duration
+	Tokens  tokenUsage
+	Rect    screenRect
+	Profile string
+	// Redacted: see ocrResult. History keeps no thumbnail of such captures.
+	Redacted bool
+}
+
+func newOCROutput(res *ocrResult, at time.Time, profile string, rect screenRect) *ocrOutput {
+	return &ocrOutput{
+		Text:    res.Text,
+		Boxes:   res.Boxes,
+		Time:    at,
+		Backend: res.Backend,
+		Latency: res.Latency,
+		Tokens:  res.Tokens,
+		Rect:    rect,
+		Profile: profile,
+
+		Redacted: res.Redacted,
+	}
+}
+
+// Lines is the text split into lines, for templates.
+func (o *ocrOutput) Lines() []string {
+	if o.Text == "" {
+		return nil
+	}
+	return strings.Split(o.Text, "\n")
+}
+
+// sink writes a rendered payload somewhere.
+type sink interface {
+	name() string
+	write(ctx context.Context, out *ocrOutput, payload string) error
+}
+
+// outputSink is a sink together with the template that renders its payload.
+type outputSink struct {
+	sink
+	tmpl *template.Template
+}
+
+type sinkConfig struct {
+	Type     string `json:"type"`               // clipboard, messagebox, stdout, file, folder, webhook, exec
+	Template string `json:"template,omitempty"` // text/template; default depends on the type
+
+	Path     string `json:"path,omitempty"`      // file: file to append to; folder: directory
+	MaxSize  int64  `json:"max_size,omitempty"`  // file: rotate once it would grow past this (bytes)
+	MaxFiles int    `json:"max_files,omitempty"` // file: rotated files kept (default 3)
+
+	URL     string            `json:"url,omitempty"`     // webhook
+	Headers map[string]string `json:"headers,omitempty"` // webhook
+
+	Command []string `json:"command,omitempty"` // exec: program and arguments
+
+	Timeout duration `json:"timeout,omitempty"` // webhook, exec (default 10s)
+}
+
+// defaultSinkTemplates reproduce each sink's plain output.
+var defaultSinkTemplates = map[string]string{
+	"clipboard":  `{{.Text}}`,
+	"messagebox": `{{.Text}}`,
+	"stdout":     `[{{.Time.Format "2006-01-02 15:04:05"}}] {{.Text}}` + "\n",
+	"file":       `--- {{.Time.Format "2006-01-02 15:04:05"}} ({{.Profile}}) ---` + "\n{{.Text}}\n\n",
+	"folder":     `{{.Text}}`,
+	"webhook":    `{"text":{{json .Text}},"time":{{json .Time}},"profile":{{json .Profile}},"rect":{{json .Rect}}}`,
+	"exec":       `{{.Text}}`,
+}
+
+// sinkFuncs are the helpers available in sink templates.
+var sinkFuncs = template.FuncMap{
+	"trim": strings.TrimSpace,
+	// joinLines folds the lines of s into one, separated by sep.
+	"joinLines": func(sep, s string) string {
+		var lines []string
+		for _, l := range strings.Split(s, "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				lines = append(lines, l)
+			}
+		}
+		return strings.Join(lines, sep)
+	},
+	"join": func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	// json renders v as a JSON value, e.g. a quoted and escaped string.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"markdown": escapeMarkdown,
+}
+
+// markdownEscaper escapes the characters that change inline Markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "|", `\|`, "#", `\#`,
+)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// parseSinkTemplate parses a sink template and runs it once against a
+// sample result, so unknown fields and bad function calls are reported
+// when the config loads rather than at the first capture.
+func parseSinkTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(sinkFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := &ocrOutput{
+		Text:    "sample line 1\nsample line 2",
+		Boxes:   []ocrBox{{Text: "sample line 1", W: 100, H: 20}, {Text: "sample line 2", Y: 24, W: 100, H: 20}},
+		Time:    time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC),
+		Backend: "http://127.0.0.1:8000/upload",
+		Latency: 1234 * time.Millisecond,
+		Tokens:  tokenUsage{Prompt: 800, Completion: 20, Total: 820},
+		Rect:    screenRect{W: 100, H: 44},
+		Profile: "default",
+	}
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *outputSink) render(out *ocrOutput) (string, error) {
+	var b strings.Builder
+	if err := s.tmpl.Execute(&b, out); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// newSink builds a sink from its config. copied tells a message box that a
+// clipboard sink runs alongside it.
+func newSink(c sinkConfig, copied bool) (*outputSink, error) {
+	text := c.Template
+	if text == "" {
+		text = defaultSinkTemplates[c.Type]
+	}
+	tmpl, err := parseSinkTemplate(c.Type, text)
+	if err != nil {
+		return nil, fmt.Errorf("%s sink template: %w", c.Type, err)
+	}
+	s, err := newSinkWriter(c, copied)
+	if err != nil {
+		return nil, err
+	}
+	return &outputSink{sink: s, tmpl: tmpl}, nil
+}
+
+func newSinkWriter(c sinkConfig, copied bool) (sink, error) {
+	timeout := time.Duration(c.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	switch c.Type {
+	case "clipboard":
+		return newClipboardSink()
+	case "messagebox":
+		return newMessageBoxSink(copied)
+	case "stdout":
+		return stdoutSink{}, nil
+	case "file":
+		if c.Path == "" {
+			return nil, fmt.Errorf("file sink: path is required")
+		}
+		maxFiles := c.MaxFiles
+		if maxFiles <= 0 {
+			maxFiles = 3
+		}
+		return &fileSink{path: c.Path, maxSize: c.MaxSize, maxFiles: maxFiles}, nil
+	case "folder":
+		if c.Path == "" {
+			return nil, fmt.Errorf("folder sink: path is required")
+		}
+		return &folderSink{dir: c.Path}, nil
+	case "webhook":
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook sink: url is required")
+		}
+		return &webhookSink{url: c.URL, headers: c.Headers, client: &http.Client{Timeout: timeout}}, nil
+	case "exec":
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("exec sink: command is required")
+		}
+		return &execSink{command: c.Command, timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", c.Type)
+}
+
+// newSinks builds a profile's sink list.
+func newSinks(cfgs []sinkConfig) ([]*outputSink, error) {
+	copied := false
+	for _, c := range cfgs {
+		copied = copied || c.Type == "clipboard"
+	}
+	sinks := make([]*outputSink, 0, len(cfgs))
+	for _, c := range cfgs {
+		s, err := newSink(c, copied)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// deliver hands out to every sink concurrently, so a slow or failing sink
+// (or a message box waiting to be closed) does not hold up the others.
+// Failures are logged and returned joined.
+func deliver(ctx context.Context, sinks []*outputSink, out *ocrOutput) error {
+	errs := make([]error, len(sinks))
+	var wg sync.WaitGroup
+	for i, s := range sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload, err := s.render(out)
+			if err == nil {
+				err = s.write(ctx, out, payload)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", s.name(), err)
+				fmt.Printf("[OCR] Sink %v\n", errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// stdout
+
+type stdoutSink struct{}
+
+func (stdoutSink) name() string { return "stdout" }
+
+func (stdoutSink) write(_ context.Context, _ *ocrOutput, payload string) error {
+	_, err := io.WriteString(os.Stdout, payload)
+	return err
+}
+
+// file: append, rotating path -> path.1 -> path.2 ...
+
+type fileSink struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+}
+
+func (s *fileSink) name() string { return "file " + s.path }
+
+func (s *fileSink) write(_ context.Context, _ *ocrOutput, entry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	if s.maxSize > 0 {
+		if fi, err := os.Stat(s.path); err == nil && fi.Size() > 0 && fi.Size()+int64(len(entry)) > s.maxSize {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, entry)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *fileSink) rotate() error {
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", s.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", s.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+// folder: one file per capture
+
+type folderSink struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func (s *folderSink) name() string { return "folder " + s.dir }
+
+func (s *folderSink) write(_ context.Context, out *ocrOutput, payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	base := "ocr-" + out.Time.Format("20060102-150405.000")
+	path := filepath.Join(s.dir, base+".txt")
+	for i := 2; ; i++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			path = filepath.Join(s.dir, fmt.Sprintf("%s-%d.txt", base, i))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, payload)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// webhook: POST JSON
+
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *webhookSink) name() string { return "webhook " + s.url }
+
+func (s *webhookSink) write(ctx context.Context, _ *ocrOutput, payload string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 800))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// exec: run a command with the text on stdin
+
+type execSink struct {
+	command []string
+	timeout time.Duration
+}
+
+func (s *execSink) name() string { return "exec " + s.command[0] }
+
+func (s *execSink) write(ctx context.Context, out *ocrOutput, payload string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = strings.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"OCRBOARD_PROFILE="+out.Profile,
+		"OCRBOARD_TIME="+out.Time.Format(time.RFC3339),
+	)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		msg := strings.TrimSpace(string(b))
+		if len(msg) > 800 {
+			msg = msg[:800]
+		}
+		if msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
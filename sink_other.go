@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+func newClipboardSink() (sink, error) {
+	return nil, fmt.Errorf("clipboard sink is only available on Windows")
+}
+
+func newMessageBoxSink(copied bool) (sink, error) {
+	return nil, fmt.Errorf("messagebox sink is only available on Windows")
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testOutput(text string) *ocrOutput {
+	return &ocrOutput{
+		Text:    text,
+		Time:    time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		Backend: "http://127.0.0.1:8000/upload",
+		Profile: "docs",
+	}
+}
+
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(b)
+	}
+	return files
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSize  int64
+		maxFiles int
+		writes   []string
+		want     map[string]string
+	}{
+		{"no limit", 0, 0, []string{"aaaa", "bbbb", "cccc"},
+			map[string]string{"out.txt": "aaaabbbbcccc"}},
+		{"rotate past max_size", 8, 0, []string{"aaaa", "bbbb", "cccc"},
+			map[string]string{"out.txt": "cccc", "out.txt.1": "aaaabbbb"}},
+		{"keep max_files", 4, 2, []string{"aaaa", "bbbb", "cccc", "dddd"},
+			map[string]string{"out.txt": "dddd", "out.txt.1": "cccc", "out.txt.2": "bbbb"}},
+		{"oversized entry to an empty file", 4, 2, []string{"a long entry"},
+			map[string]string{"out.txt": "a long entry"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "logs") // created on the first write
+			s, err := newSink(sinkConfig{Type: "file", Path: filepath.Join(dir, "out.txt"),
+				MaxSize: tt.maxSize, MaxFiles: tt.maxFiles, Template: "{{.Text}}"}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.writes {
+				if err := deliver(context.Background(), []*outputSink{s}, testOutput(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := readDir(t, dir); !maps.Equal(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFolderSinkCollisions(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSink(sinkConfig{Type: "folder", Path: dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same timestamp every time, written concurrently.
+	var wg sync.WaitGroup
+	for _, text := range []string{"one", "two", "three"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := deliver(context.Background(), []*outputSink{s}, testOutput(text)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	files := readDir(t, dir)
+	var names, texts []string
+	for name, text := range files {
+		names = append(names, name)
+		texts = append(texts, text)
+	}
+	slices.Sort(names)
+	slices.Sort(texts)
+	wantNames := []string{"ocr-20240506-070809.000-2.txt", "ocr-20240506-070809.000-3.txt", "ocr-20240506-070809.000.txt"}
+	if !slices.Equal(names, wantNames) || !slices.Equal(texts, []string{"one", "three", "two"}) {
+		t.Errorf("files = %q", files)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{"ok", http.StatusOK, ""},
+		{"no content", http.StatusNoContent, ""},
+		{"rejected", http.StatusBadRequest, "HTTP 400: bad payload"},
+		{"server error", http.StatusInternalServerError, "HTTP 500: bad payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body, contentType, token string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body, contentType, token = string(b), r.Header.Get("Content-Type"), r.Header.Get("X-Token")
+				w.WriteHeader(tt.status)
+				if tt.status >= 300 {
+					w.Write([]byte("bad payload"))
+				}
+			}))
+			defer srv.Close()
+
+			s, err := newSink(sinkConfig{Type: "webhook", URL: srv.URL, Headers: map[string]string{"X-Token": "t0k"}}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = deliver(context.Background(), []*outputSink{s}, testOutput("line \"1\"\nline 2"))
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			want := `{"text":"line \"1\"\nline 2","time":"2024-05-06T07:08:09Z","profile":"docs","rect":{"x":0,"y":0,"w":0,"h":0}}`
+			if body != want || contentType != "application/json" || token != "t0k" {
+				t.Errorf("got %s (%s, token %q)", body, contentType, token)
+			}
+		})
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		command []string
+		timeout duration
+		want    string // contents of dir/out
+		wantErr string
+	}{
+		{"stdin and env", []string{"sh", "-c", `{ cat; echo; echo "$OCRBOARD_PROFILE $OCRBOARD_TIME"; } > "$0/out"`, dir},
+			0, "hello\nworld\ndocs 2024-05-06T07:08:09Z\n", ""},
+		{"exit status with output", []string{"sh", "-c", "echo broken pipe >&2; exit 3"}, 0, "", "exit status 3: broken pipe"},
+		{"timeout", []string{"sleep", "5"}, duration(50 * time.Millisecond), "", "killed"},
+		{"missing program", []string{filepath.Join(dir, "nothing")}, 0, "", "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(filepath.Join(dir, "out"))
+			s, err := newSink(sinkConfig{Type: "exec", Command: tt.command, Timeout: tt.timeout}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = deliver(context.Background(), []*outputSink{s}, testOutput("hello\nworld"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(dir, "out")); string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordSink remembers its payloads, or fails.
+type recordSink struct {
+	mu   sync.Mutex
+	got  []string
+	fail bool
+}
+
+func (s *recordSink) name() string { return "record" }
+
+func (s *recordSink) write(_ context.Context, _ *ocrOutput, payload string) error {
+	if s.fail {
+		return io.ErrClosedPipe
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.got = append(s.got, payload)
+	return nil
+}
+
+func TestDeliverPastFailures(t *testing.T) {
+	mustTmpl := func(text string) *outputSink {
+		tmpl, err := parseSinkTemplate("test", text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &outputSink{tmpl: tmpl}
+	}
+	first, broken, last := &recordSink{}, &recordSink{fail: true}, &recordSink{}
+	sinks := []*outputSink{mustTmpl("{{.Text}}"), mustTmpl("{{.Text}}"), mustTmpl("{{.Profile}}: {{.Text}}")}
+	sinks[0].sink, sinks[1].sink, sinks[2].sink = first, broken, last
+
+	err := deliver(context.Background(), sinks, testOutput("hello"))
+	if err == nil || !strings.Contains(err.Error(), "record: io: read/write on closed pipe") {
+		t.Errorf("err = %v", err)
+	}
+	if !slices.Equal(first.got, []string{"hello"}) || !slices.Equal(last.got, []string{"docs: hello"}) {
+		t.Errorf("payloads = %q, %q", first.got, last.got)
+	}
+}
+
+func TestNewSinkErrors(t *testing.T) {
+	tests := []sinkConfig{
+		{Type: "file"},
+		{Type: "folder"},
+		{Type: "webhook"},
+		{Type: "exec"},
+		{Type: "carrier pigeon"},
+	}
+	for _, c := range tests {
+		if _, err := newSink(c, false); err == nil {
+			t.Errorf("%+v: no error", c)
+		}
+	}
+}
+
+func TestSinkTemplates(t *testing.T) {
+	out := testOutput("  Total: *42* | [ok]\n\n  second <line>  ")
+	out.Latency = 1500 * time.Millisecond
+	out.Tokens = tokenUsage{Total: 99}
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    string
+		wantErr string // at parse time
+	}{
+		{"fields", `{{.Profile}} {{.Time.Format "15:04"}} {{.Latency}} {{.Tokens.Total}}`, "docs 07:08 1.5s 99", ""},
+		{"trim", `[{{trim .Text}}]`, "[Total: *42* | [ok]\n\n  second <line>]", ""},
+		{"joinLines", `{{joinLines " / " .Text}}`, "Total: *42* | [ok] / second <line>", ""},
+		{"join", `{{join "," .Lines}}`, "  Total: *42* | [ok],,  second <line>  ", ""},
+		{"json", `{{json .Text}} {{json .Profile}}`, `"  Total: *42* | [ok]\n\n  second \u003cline\u003e  " "docs"`, ""},
+		{"markdown", `{{markdown (trim .Text)}}`, "Total: \\*42\\* \\| \\[ok\\]\n\n  second \\<line\\>", ""},
+		{"range over lines", `{{range .Lines}}{{with trim .}}- {{.}}` + "\n" + `{{end}}{{end}}`, "- Total: *42* | [ok]\n- second <line>\n", ""},
+		{"unknown field", `{{.Txt}}`, "", "can't evaluate field Txt"},
+		{"unknown function", `{{upper .Text}}`, "", `function "upper" not defined`},
+		{"wrong argument", `{{join "," .Text}}`, "", "wrong type for value"},
+		{"syntax", `{{.Text`, "", "unclosed action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSink(sinkConfig{Type: "stdout", Template: tt.tmpl}, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.render(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultSinkTemplates(t *testing.T) {
+	for typ, text := range defaultSinkTemplates {
+		if _, err := parseSinkTemplate(typ, text); err != nil {
+			t.Errorf("%s: %v", typ, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package main
+
+import "context"
+
+type clipboardSink struct{}
+
+func newClipboardSink() (sink, error) { return clipboardSink{}, nil }
+
+func (clipboardSink) name() string { return "clipboard" }
+
+func (clipboardSink) write(_ context.Context, _ *ocrOutput, payload string) error {
+	return setClipboardText(payload)
+}
+
+// messageBoxSink shows the result in a topmost message box, truncated to
+// what fits on screen.
+type messageBoxSink struct {
+	copied bool // a clipboard sink runs alongside
+}
+
+func newMessageBoxSink(copied bool) (sink, error) { return messageBoxSink{copied: copied}, nil }
+
+func (messageBoxSink) name() string { return "messagebox" }
+
+func (s messageBoxSink) write(_ context.Context, _ *ocrOutput, payload string) error {
+	msg := payload
+	if msg == "" {
+		msg = "(empty)"
+	}
+	title := "OCR Result"
+	if s.copied {
+		title = "OCR Result (Copied to clipboard)"
+	}
+	runes := []rune(msg)
+	if len(runes) > 2000 {
+		msg = string(runes[:2000]) + "\n\n...(Content truncated)"
+		if s.copied {
+			msg = string(runes[:2000]) + "\n\n...(Content truncated. Full text has been copied to the clipboard)"
+		}
+	}
+	messageBoxTop(title, msg)
+	return nil
+}
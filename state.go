@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// =========================
+// Persistent state (last region per profile)
+// =========================
+
+// screenRect is a rectangle in virtual-screen coordinates.
+type screenRect struct {
+	X int32 `json:"x"`
+	Y int32 `json:"y"`
+	W int32 `json:"w"`
+	H int32 `json:"h"`
+}
+
+func rectLTRB(l, t, r, b int32) screenRect {
+	return screenRect{X: l, Y: t, W: max(0, r-l), H: max(0, b-t)}
+}
+
+func (r screenRect) right() int32  { return r.X + r.W }
+func (r screenRect) bottom() int32 { return r.Y + r.H }
+
+// savedRegion is a selection together with the virtual screen it was made
+// on, so a later monitor layout change can be noticed.
+type savedRegion struct {
+	Rect   screenRect `json:"rect"`
+	Screen screenRect `json:"screen"`
+}
+
+type appState struct {
+	mu      sync.Mutex
+	path    string
+	Regions map[string]savedRegion `json:"regions"`
+}
+
+func loadState(path string) *appState {
+	st := &appState{path: path, Regions: make(map[string]savedRegion)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("[OCR] state: %v\n", err)
+		}
+		return st
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		fmt.Printf("[OCR] state %s: %v\n", path, err)
+	}
+	if st.Regions == nil {
+		st.Regions = make(map[string]savedRegion)
+	}
+	return st
+}
+
+func (s *appState) region(profile string) (savedRegion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.Regions[profile]
+	return r, ok
+}
+
+func (s *appState) setRegion(profile string, r savedRegion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Regions[profile] = r
+	return s.saveLocked()
+}
+
+func (s *appState) clearRegion(profile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Regions, profile)
+	return s.saveLocked()
+}
+
+func (s *appState) saveLocked() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// resolveRegion fits a saved region onto the current virtual screen. When
+// the layout changed, the region is clamped to what is still visible;
+// ok is false when too little of it is left to be worth capturing.
+func resolveRegion(saved savedRegion, screen screenRect) (r screenRect, clamped, ok bool) {
+	r = saved.Rect
+	if saved.Screen == screen {
+		return r, false, r.W >= 3 && r.H >= 3
+	}
+
+	l := max(r.X, screen.X)
+	t := max(r.Y, screen.Y)
+	rr := min(r.right(), screen.right())
+	b := min(r.bottom(), screen.bottom())
+	if rr-l < 3 || b-t < 3 {
+		return screenRect{}, true, false
+	}
+	clamped = l != r.X || t != r.Y || rr != r.right() || b != r.bottom()
+	return screenRect{X: l, Y: t, W: rr - l, H: b - t}, clamped, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveRegion(t *testing.T) {
+	dual := screenRect{X: 0, Y: 0, W: 3840, H: 1080}
+	single := screenRect{X: 0, Y: 0, W: 1920, H: 1080}
+	leftOf := screenRect{X: -1920, Y: 0, W: 3840, H: 1080} // second monitor moved to the left
+
+	tests := []struct {
+		name    string
+		saved   savedRegion
+		screen  screenRect
+		want    screenRect
+		clamped bool
+		ok      bool
+	}{
+		{"same layout", savedRegion{screenRect{2000, 100, 400, 300}, dual}, dual,
+			screenRect{2000, 100, 400, 300}, false, true},
+		{"same layout, too small", savedRegion{screenRect{10, 10, 2, 50}, dual}, dual,
+			screenRect{10, 10, 2, 50}, false, false},
+		{"layout changed, still visible", savedRegion{screenRect{100, 100, 400, 300}, dual}, single,
+			screenRect{100, 100, 400, 300}, false, true},
+		{"straddles the lost monitor", savedRegion{screenRect{1800, 200, 400, 300}, dual}, single,
+			screenRect{1800, 200, 120, 300}, true, true},
+		{"on the lost monitor", savedRegion{screenRect{2500, 200, 400, 300}, dual}, single,
+			screenRect{}, true, false},
+		{"barely visible", savedRegion{screenRect{1918, 200, 400, 300}, dual}, single,
+			screenRect{}, true, false},
+		{"negative coordinates", savedRegion{screenRect{-1800, 100, 300, 200}, leftOf}, leftOf,
+			screenRect{-1800, 100, 300, 200}, false, true},
+		{"monitor above removed", savedRegion{screenRect{-1900, -20, 300, 200}, screenRect{X: -1920, Y: -40, W: 3840, H: 1120}}, leftOf,
+			screenRect{-1900, 0, 300, 180}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, clamped, ok := resolveRegion(tt.saved, tt.screen)
+			if ok != tt.ok || clamped != tt.clamped || (ok && got != tt.want) {
+				t.Errorf("got %+v clamped=%v ok=%v, want %+v clamped=%v ok=%v",
+					got, clamped, ok, tt.want, tt.clamped, tt.ok)
+			}
+		})
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+	st := loadState(path) // missing file: empty state
+	r := savedRegion{Rect: screenRect{10, 20, 300, 200}, Screen: screenRect{0, 0, 1920, 1080}}
+	if err := st.setRegion("docs", r); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := loadState(path).region("docs"); !ok || got != r {
+		t.Errorf("reloaded %+v, %v", got, ok)
+	}
+	if err := st.clearRegion("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadState(path).region("docs"); ok {
+		t.Error("cleared region still saved")
+	}
+}
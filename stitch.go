@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// =========================
+// Scrolling capture (stitch frames)
+// =========================
+
+const (
+	stitchBins       = 64 // luma columns per row signature
+	stitchRowTol     = 2  // mean per-bin luma difference of rows that match
+	stitchMinOverlap = 16 // rows two frames must share to be aligned
+)
+
+// rowSigs reduces every row to stitchBins average luma values. Comparing
+// signatures instead of raw pixels keeps the offset search cheap and
+// forgiving of sub-pixel font smoothing.
+func rowSigs(img *image.RGBA) [][stitchBins]int32 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	sigs := make([][stitchBins]int32, h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		var sum, cnt [stitchBins]int32
+		for x := 0; x < w; x++ {
+			bin := x * stitchBins / w
+			sum[bin] += int32(luma(row[x*4:]))
+			cnt[bin]++
+		}
+		for i := range sum {
+			if cnt[i] > 0 {
+				sigs[y][i] = sum[i] / cnt[i]
+			}
+		}
+	}
+	return sigs
+}
+
+func sigDiff(a, b *[stitchBins]int32) int32 {
+	var d int32
+	for i := range a {
+		v := a[i] - b[i]
+		if v < 0 {
+			v = -v
+		}
+		d += v
+	}
+	return d
+}
+
+// flatSig reports a row with no structure (background), which matches
+// anything and so carries no information about the scroll offset.
+func flatSig(s *[stitchBins]int32) bool {
+	lo, hi := s[0], s[0]
+	for _, v := range s[1:] {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	return hi-lo < 8
+}
+
+// scrollPair describes how frame b continues frame a.
+type scrollPair struct {
+	header, footer int // fixed rows at the top/bottom shared by both frames
+	offset         int // rows the content scrolled up; 0 means a duplicate
+}
+
+// matchScroll finds the vertical offset between two consecutive frames of
+// the same region by correlating their row signatures. Rows that do not
+// move (sticky headers, footers) are found first and left out of the
+// search.
+func matchScroll(a, b [][stitchBins]int32) (scrollPair, error) {
+	h := len(a)
+	if h != len(b) {
+		return scrollPair{}, fmt.Errorf("frames differ in size")
+	}
+
+	same := func(y int) bool { return sigDiff(&a[y], &b[y]) <= stitchBins/2 }
+	var p scrollPair
+	for p.header < h && same(p.header) {
+		p.header++
+	}
+	if p.header == h {
+		return p, nil
+	}
+	for p.footer < h-p.header && same(h-1-p.footer) {
+		p.footer++
+	}
+
+	band := h - p.header - p.footer
+	bestCost, bestOff := int64(-1), 0
+	for off := 1; off <= band-stitchMinOverlap; off++ {
+		var cost int64
+		n := 0
+		for y := 0; y < band-off; y++ {
+			sa := &a[p.header+y+off]
+			sb := &b[p.header+y]
+			if flatSig(sa) && flatSig(sb) {
+				continue
+			}
+			cost += int64(sigDiff(sa, sb))
+			n++
+		}
+		if n < stitchMinOverlap/2 {
+			continue
+		}
+		cost = cost / int64(n)
+		if bestCost < 0 || cost < bestCost {
+			bestCost, bestOff = cost, off
+		}
+	}
+	if bestCost < 0 || bestCost > stitchRowTol*stitchBins {
+		return p, fmt.Errorf("frames do not overlap; scroll less between grabs")
+	}
+	p.offset = bestOff
+	return p, nil
+}
+
+// stitchFrames joins frames grabbed from the same region while scrolling
+// down into one tall image. Duplicate frames are skipped, rows seen in the
+// previous frame are dropped, and fixed headers/footers appear once.
+func stitchFrames(frames []*image.RGBA) (*image.RGBA, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames")
+	}
+	first := frames[0]
+	w, h := first.Bounds().Dx(), first.Bounds().Dy()
+
+	type piece struct {
+		img      *image.RGBA
+		from, to int
+	}
+	var pieces []piece
+	footer := h
+	last := first
+
+	prev := rowSigs(first)
+	for _, fr := range frames[1:] {
+		if fr.Bounds().Dx() != w || fr.Bounds().Dy() != h {
+			return nil, fmt.Errorf("frames differ in size")
+		}
+		cur := rowSigs(fr)
+		p, err := matchScroll(prev, cur)
+		if err != nil {
+			return nil, err
+		}
+		if p.offset == 0 {
+			continue
+		}
+		footer = min(footer, p.footer)
+		bandEnd := h - p.footer
+		pieces = append(pieces, piece{img: fr, from: bandEnd - p.offset, to: bandEnd})
+		prev, last = cur, fr
+	}
+	if footer == h {
+		footer = 0
+	}
+
+	total := h
+	for _, pc := range pieces {
+		total += pc.to - pc.from
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, total))
+
+	y := 0
+	copyRows := func(src *image.RGBA, from, to int) {
+		for r := from; r < to; r++ {
+			copy(out.Pix[out.PixOffset(0, y):out.PixOffset(0, y)+w*4], src.Pix[src.PixOffset(src.Bounds().Min.X, src.Bounds().Min.Y+r):])
+			y++
+		}
+	}
+	copyRows(first, 0, h-footer)
+	for _, pc := range pieces {
+		copyRows(pc.img, pc.from, pc.to)
+	}
+	copyRows(last, h-footer, h)
+	return out, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// scrollDoc is a synthetic page: every row is a different pattern of grey
+// blocks, like lines of text at signature resolution.
+func scrollDoc(w, h int, seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x0 := 0; x0 < w; x0 += 8 {
+			v := uint8(rng.Intn(256))
+			for x := x0; x < min(x0+8, w); x++ {
+				img.SetRGBA(x, y, color.RGBA{v, v, v, 0xFF})
+			}
+		}
+	}
+	return img
+}
+
+// scrollFrames cuts frames of height h out of doc at the given scroll
+// offsets, with header rows of top on top and footer rows of bottom below.
+func scrollFrames(doc, top, bottom *image.RGBA, h int, offsets []int) []*image.RGBA {
+	w := doc.Bounds().Dx()
+	var hh, fh int
+	if top != nil {
+		hh = top.Bounds().Dy()
+	}
+	if bottom != nil {
+		fh = bottom.Bounds().Dy()
+	}
+	var frames []*image.RGBA
+	for _, off := range offsets {
+		fr := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			var src []byte
+			switch {
+			case y < hh:
+				src = top.Pix[top.PixOffset(0, y):]
+			case y >= h-fh:
+				src = bottom.Pix[bottom.PixOffset(0, y-(h-fh)):]
+			default:
+				src = doc.Pix[doc.PixOffset(0, off+y-hh):]
+			}
+			copy(fr.Pix[fr.PixOffset(0, y):][:w*4], src)
+		}
+		frames = append(frames, fr)
+	}
+	return frames
+}
+
+// stackRows joins row ranges of images into one.
+func stackRows(w int, parts ...*image.RGBA) *image.RGBA {
+	h := 0
+	for _, p := range parts {
+		h += p.Bounds().Dy()
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	y := 0
+	for _, p := range parts {
+		for r := 0; r < p.Bounds().Dy(); r++ {
+			copy(out.Pix[out.PixOffset(0, y):][:w*4], p.Pix[p.PixOffset(p.Bounds().Min.X, p.Bounds().Min.Y+r):])
+			y++
+		}
+	}
+	return out
+}
+
+func rows(img *image.RGBA, from, to int) *image.RGBA {
+	return img.SubImage(image.Rect(0, from, img.Bounds().Dx(), to)).(*image.RGBA)
+}
+
+func TestStitchFrames(t *testing.T) {
+	const w, h = 256, 160
+	doc := scrollDoc(w, 1000, 1)
+	top := scrollDoc(w, 24, 2)
+	bottom := scrollDoc(w, 12, 3)
+	band := h - 24 - 12
+
+	tests := []struct {
+		name    string
+		top     *image.RGBA
+		bottom  *image.RGBA
+		offsets []int
+		want    *image.RGBA
+	}{
+		{"single frame", nil, nil, []int{0}, rows(doc, 0, h)},
+		{"even scroll", nil, nil, []int{0, 40, 80, 120}, rows(doc, 0, 120+h)},
+		{"uneven scroll", nil, nil, []int{0, 17, 90, 91, 200}, rows(doc, 0, 200+h)},
+		{"duplicates skipped", nil, nil, []int{0, 0, 50, 50, 50, 100}, rows(doc, 0, 100+h)},
+		{"header and footer once", top, bottom, []int{0, 30, 60, 100},
+			stackRows(w, top, rows(doc, 0, 100+band), bottom)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stitchFrames(scrollFrames(doc, tt.top, tt.bottom, h, tt.offsets))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Bounds().Dy() != tt.want.Bounds().Dy() {
+				t.Fatalf("height = %d, want %d", got.Bounds().Dy(), tt.want.Bounds().Dy())
+			}
+			for y := 0; y < got.Bounds().Dy(); y++ {
+				g := got.Pix[got.PixOffset(0, y):][:w*4]
+				wnt := tt.want.Pix[tt.want.PixOffset(0, tt.want.Bounds().Min.Y+y):][:w*4]
+				if !bytes.Equal(g, wnt) {
+					t.Fatalf("row %d differs", y)
+				}
+			}
+		})
+	}
+}
+
+func TestStitchFramesErrors(t *testing.T) {
+	doc := scrollDoc(128, 1000, 4)
+	tests := []struct {
+		name   string
+		frames []*image.RGBA
+	}{
+		{"no frames", nil},
+		{"no overlap", scrollFrames(doc, nil, nil, 100, []int{0, 400})},
+		{"size changed", []*image.RGBA{rows(doc, 0, 100), rows(doc, 20, 140)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := stitchFrames(tt.frames); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
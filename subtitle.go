@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// =========================
+// Subtitle extraction (SRT / WebVTT)
+// =========================
+
+type subtitleConfig struct {
+	Interval    duration `json:"interval,omitempty"`     // time between captures
+	Threshold   float64  `json:"threshold,omitempty"`    // changed-pixel fraction that counts as a change
+	Format      string   `json:"format,omitempty"`       // "srt" or "vtt"
+	Dir         string   `json:"dir,omitempty"`          // output folder
+	MinDuration duration `json:"min_duration,omitempty"` // shorter cues are dropped
+	MergeGap    duration `json:"merge_gap,omitempty"`    // similar cues this close are joined
+	Similarity  float64  `json:"similarity,omitempty"`   // 0..1, how alike two lines must be to merge
+}
+
+func (c *subtitleConfig) withDefaults() subtitleConfig {
+	out := subtitleConfig{
+		Interval:    duration(250 * time.Millisecond),
+		Threshold:   0.002,
+		Format:      "srt",
+		Dir:         filepath.Join(configDir(), "subtitles"),
+		MinDuration: duration(300 * time.Millisecond),
+		MergeGap:    duration(500 * time.Millisecond),
+		Similarity:  0.8,
+	}
+	if c == nil {
+		return out
+	}
+	if c.Interval > 0 {
+		out.Interval = c.Interval
+	}
+	if c.Threshold > 0 {
+		out.Threshold = c.Threshold
+	}
+	if c.Format != "" {
+		out.Format = strings.ToLower(c.Format)
+	}
+	if c.Dir != "" {
+		out.Dir = c.Dir
+	}
+	if c.MinDuration > 0 {
+		out.MinDuration = c.MinDuration
+	}
+	if c.MergeGap > 0 {
+		out.MergeGap = c.MergeGap
+	}
+	if c.Similarity > 0 {
+		out.Similarity = c.Similarity
+	}
+	return out
+}
+
+func (c subtitleConfig) validate() error {
+	switch c.Format {
+	case "srt", "vtt":
+	default:
+		return fmt.Errorf("subtitle format %q: want srt or vtt", c.Format)
+	}
+	if c.Similarity > 1 {
+		return fmt.Errorf("subtitle similarity %g: want 0..1", c.Similarity)
+	}
+	return nil
+}
+
+type subtitleCue struct {
+	Start, End time.Duration
+	Text       string
+}
+
+// subtitleRecorder turns captures of a subtitle band into timed cues. A
+// capture is only OCR'd when its pixels changed; consecutive near-identical
+// readings extend the current cue instead of starting a new one.
+type subtitleRecorder struct {
+	src frameSource
+	cfg subtitleConfig
+	now func() time.Time
+	ocr func(ctx context.Context, img *image.RGBA) (string, error)
+
+	start time.Time
+	prev  *image.RGBA
+	cur   *subtitleCue
+	cues  []subtitleCue
+}
+
+func (r *subtitleRecorder) elapsed() time.Duration {
+	if r.start.IsZero() {
+		r.start = r.now()
+	}
+	return r.now().Sub(r.start)
+}
+
+// step performs one capture.
+func (r *subtitleRecorder) step(ctx context.Context) error {
+	img, err := r.src.grab()
+	if err != nil {
+		return err
+	}
+	at := r.elapsed()
+
+	if r.prev != nil && frameDiff(img, r.prev) <= r.cfg.Threshold {
+		return nil
+	}
+
+	text, err := r.ocr(ctx, img)
+	if err != nil {
+		return err
+	}
+	r.prev = img
+	text = cleanSubtitle(text)
+
+	if r.cur != nil && r.similar(r.cur.Text, text) {
+		return nil
+	}
+	r.closeCue(at)
+	if text != "" {
+		r.cur = &subtitleCue{Start: at, Text: text}
+	}
+	return nil
+}
+
+// finish closes the open cue at the current time and returns all cues.
+func (r *subtitleRecorder) finish() []subtitleCue {
+	r.closeCue(r.elapsed())
+	return r.cues
+}
+
+func (r *subtitleRecorder) closeCue(at time.Duration) {
+	c := r.cur
+	r.cur = nil
+	if c == nil {
+		return
+	}
+	c.End = at
+
+	// A flicker between two readings of the same line joins them.
+	if n := len(r.cues); n > 0 {
+		last := &r.cues[n-1]
+		if c.Start-last.End <= time.Duration(r.cfg.MergeGap) && r.similar(last.Text, c.Text) {
+			last.End = c.End
+			return
+		}
+	}
+	if c.End-c.Start < time.Duration(r.cfg.MinDuration) {
+		return
+	}
+	r.cues = append(r.cues, *c)
+}
+
+func (r *subtitleRecorder) similar(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if a == "" || b == "" {
+		return false
+	}
+	n := max(utf8.RuneCountInString(a), utf8.RuneCountInString(b))
+	return 1-float64(editDistance(a, b))/float64(n) >= r.cfg.Similarity
+}
+
+// cleanSubtitle trims every line and drops empty ones.
+func cleanSubtitle(s string) string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// run steps the recorder every interval until ctx is canceled.
+func (r *subtitleRecorder) run(ctx context.Context, onErr func(error)) []subtitleCue {
+	t := time.NewTicker(time.Duration(r.cfg.Interval))
+	defer t.Stop()
+	for {
+		if err := r.step(ctx); err != nil && ctx.Err() == nil {
+			onErr(err)
+		}
+		select {
+		case <-ctx.Done():
+			return r.finish()
+		case <-t.C:
+		}
+	}
+}
+
+func writeSRT(w io.Writer, cues []subtitleCue) error {
+	for i, c := range cues {
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, cueTime(c.Start, ','), cueTime(c.End, ','), c.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeVTT(w io.Writer, cues []subtitleCue) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, c := range cues {
+		_, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n", cueTime(c.Start, '.'), cueTime(c.End, '.'), c.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cueTime formats hh:mm:ss,mmm (SRT) or hh:mm:ss.mmm (WebVTT).
+func cueTime(d time.Duration, sep byte) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// saveSubtitles writes the cues to a new file in cfg.Dir and returns its path.
+func saveSubtitles(cfg subtitleConfig, started time.Time, cues []subtitleCue) (string, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(cfg.Dir, "subtitles-"+started.Format("20060102-150405")+"."+cfg.Format)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Format == "vtt" {
+		err = writeVTT(f, cues)
+	} else {
+		err = writeSRT(f, cues)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return path, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubtitleRecorder(t *testing.T) {
+	const tick = 250 * time.Millisecond
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	tests := []struct {
+		name   string
+		script []string // one screen per tick; "" is an empty band
+		want   []subtitleCue
+	}{
+		{
+			"two lines",
+			[]string{"", "Hello", "Hello", "Hello", "Hello", "Hello", "", "", "World", "World", "World", "World"},
+			[]subtitleCue{{ms(250), ms(1500), "Hello"}, {ms(2000), ms(2750), "World"}},
+		},
+		{
+			"misread extends the cue",
+			[]string{"Hello", "Hello", "Hel1o", "Hello", "Hello", ""},
+			[]subtitleCue{{0, ms(1250), "Hello"}},
+		},
+		{
+			"flash dropped",
+			[]string{"", "Oops", "", "", "Next", "Next", "Next"},
+			[]subtitleCue{{ms(1000), ms(1500), "Next"}},
+		},
+		{
+			"gap merged",
+			[]string{"Hello", "Hello", "", "Hello", "Hello", ""},
+			[]subtitleCue{{0, ms(1250), "Hello"}},
+		},
+		{
+			"two-line cue cleaned",
+			[]string{"  first   line \n\n second line ", "  first   line \n\n second line ", ""},
+			[]subtitleCue{{0, ms(500), "first line\nsecond line"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeScreen(tick, tt.script...)
+			r := &subtitleRecorder{
+				src: s,
+				cfg: (&subtitleConfig{}).withDefaults(),
+				now: s.now,
+				ocr: s.read,
+			}
+			for range tt.script {
+				if err := r.step(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := r.finish(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	cues := []subtitleCue{
+		{Start: 1500 * time.Millisecond, End: 3 * time.Second, Text: "Hello"},
+		{Start: time.Hour + 2*time.Minute + 3*time.Second + 45*time.Millisecond, End: time.Hour + 2*time.Minute + 5*time.Second, Text: "two\nlines"},
+	}
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer) error
+		want  string
+	}{
+		{"srt", func(b *bytes.Buffer) error { return writeSRT(b, cues) },
+			"1\n00:00:01,500 --> 00:00:03,000\nHello\n\n" +
+				"2\n01:02:03,045 --> 01:02:05,000\ntwo\nlines\n\n"},
+		{"vtt", func(b *bytes.Buffer) error { return writeVTT(b, cues) },
+			"WEBVTT\n\n" +
+				"00:00:01.500 --> 00:00:03.000\nHello\n\n" +
+				"01:02:03.045 --> 01:02:05.000\ntwo\nlines\n\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := tt.write(&b); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.name, b.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"sort"
+	"strings"
+)
+
+// =========================
+// Tables from boxes
+// =========================
+
+// Table layouts for profile.Layout.
+const (
+	layoutTSV      = "tsv"      // tab-separated; pastes into Excel as cells
+	layoutCSV      = "csv"      // RFC 4180 CSV
+	layoutMarkdown = "markdown" // Markdown table, first row as header
+)
+
+// buildTable infers rows and columns from the boxes. Rows are the visual
+// lines; columns are the x ranges separated by vertical gutters, i.e. runs
+// of x that (almost) no box covers. A few boxes may cross a gutter, so a
+// cell merged across columns does not join two columns; such a box lands
+// in the column of its left edge. Boxes sharing a cell (word boxes) are
+// joined with a space, and missing cells stay empty.
+func buildTable(boxes []ocrBox) [][]string {
+	rows := groupRows(boxes)
+	if len(rows) == 0 {
+		return nil
+	}
+	bounds := columnBounds(rows)
+
+	table := make([][]string, len(rows))
+	for i, r := range rows {
+		cellsText := make([]string, len(bounds)+1)
+		for _, b := range r.boxes {
+			c := sort.SearchFloat64s(bounds, b.X)
+			t := strings.TrimSpace(b.Text)
+			if cellsText[c] != "" {
+				t = cellsText[c] + " " + t
+			}
+			cellsText[c] = t
+		}
+		table[i] = cellsText
+	}
+	return dropEmptyColumns(table)
+}
+
+// columnBounds returns the x positions (ascending) separating table
+// columns. Rows holding a single box (titles, notes, a row merged into one
+// cell) say nothing about the columns and are left out.
+func columnBounds(rows []*boxRow) []float64 {
+	var heights []float64
+	var boxes []ocrBox
+	multi := 0
+	for _, r := range rows {
+		heights = append(heights, r.bottom-r.top)
+		if len(r.boxes) >= 2 {
+			boxes = append(boxes, r.boxes...)
+			multi++
+		}
+	}
+	// Words in one cell are a space apart; columns are further apart.
+	// Boxes crossing a gutter: allow one in ten rows.
+	return gutters(boxes, multi/10, math.Max(median(heights)*0.8, 1))
+}
+
+// gutters scans the horizontal coverage of boxes and returns the middle of
+// every inner run at least minGap wide that at most tol boxes cover.
+func gutters(boxes []ocrBox, tol int, minGap float64) []float64 {
+	if len(boxes) == 0 {
+		return nil
+	}
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, b := range boxes {
+		minX = math.Min(minX, b.X)
+		maxX = math.Max(maxX, b.X+b.W)
+	}
+	n := int(math.Ceil(maxX-minX)) + 1
+	if n <= 1 || n > 1<<16 {
+		return nil
+	}
+	cover := make([]int, n)
+	for _, b := range boxes {
+		from := int(b.X - minX)
+		to := min(int(math.Ceil(b.X+b.W-minX)), n)
+		for x := from; x < to; x++ {
+			cover[x]++
+		}
+	}
+
+	var bounds []float64
+	start := -1
+	for x := 0; x <= n; x++ {
+		low := x < n && cover[x] <= tol
+		switch {
+		case low && start < 0:
+			start = x
+		case !low && start >= 0:
+			if start > 0 && x < n && float64(x-start) >= minGap {
+				bounds = append(bounds, minX+float64(start+x)/2)
+			}
+			start = -1
+		}
+	}
+	return bounds
+}
+
+func dropEmptyColumns(table [][]string) [][]string {
+	cols := 0
+	for _, row := range table {
+		cols = max(cols, len(row))
+	}
+	keep := make([]bool, cols)
+	for _, row := range table {
+		for c, v := range row {
+			if v != "" {
+				keep[c] = true
+			}
+		}
+	}
+	for i, row := range table {
+		var out []string
+		for c, v := range row {
+			if keep[c] {
+				out = append(out, v)
+			}
+		}
+		table[i] = out
+	}
+	return table
+}
+
+func formatTable(mode string, table [][]string) string {
+	switch mode {
+	case layoutCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.WriteAll(table)
+		return strings.TrimRight(buf.String(), "\n")
+
+	case layoutMarkdown:
+		if len(table) == 0 {
+			return ""
+		}
+		esc := strings.NewReplacer("|", `\|`, "\n", " ")
+		line := func(row []string) string {
+			cellsOut := make([]string, len(row))
+			for i, v := range row {
+				cellsOut[i] = esc.Replace(v)
+			}
+			return "| " + strings.Join(cellsOut, " | ") + " |"
+		}
+		out := []string{line(table[0])}
+		sep := make([]string, len(table[0]))
+		for i := range sep {
+			sep[i] = "---"
+		}
+		out = append(out, line(sep))
+		for _, row := range table[1:] {
+			out = append(out, line(row))
+		}
+		return strings.Join(out, "\n")
+
+	default: // layoutTSV
+		esc := strings.NewReplacer("\t", " ", "\n", " ")
+		out := make([]string, len(table))
+		for i, row := range table {
+			cellsOut := make([]string, len(row))
+			for j, v := range row {
+				cellsOut[j] = esc.Replace(v)
+			}
+			out[i] = strings.Join(cellsOut, "\t")
+		}
+		return strings.Join(out, "\n")
+	}
+}
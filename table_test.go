@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tableBoxes places a grid of cells: column c starts at x[c], row r at
+// r*30. Cell text may hold several words, which become separate boxes
+// 8 pixels per character apart, like a word-level backend.
+func tableBoxes(x []float64, grid [][]string) []ocrBox {
+	var boxes []ocrBox
+	for r, row := range grid {
+		for c, cell := range row {
+			pos := x[c]
+			for _, word := range strings.Fields(cell) {
+				w := float64(len(word)) * 8
+				boxes = append(boxes, ocrBox{Text: word, X: pos, Y: float64(r) * 30, W: w, H: 20})
+				pos += w + 8
+			}
+		}
+	}
+	return boxes
+}
+
+func TestBuildTable(t *testing.T) {
+	cols := []float64{0, 200, 320}
+	tests := []struct {
+		name  string
+		boxes []ocrBox
+		want  [][]string
+	}{
+		{
+			"grid with word boxes",
+			tableBoxes(cols, [][]string{
+				{"Item", "Qty", "Unit price"},
+				{"Blue pens", "12", "1.20"},
+				{"Paper A4", "500", "0.02"},
+			}),
+			[][]string{{"Item", "Qty", "Unit price"}, {"Blue pens", "12", "1.20"}, {"Paper A4", "500", "0.02"}},
+		},
+		{
+			"empty cell",
+			tableBoxes(cols, [][]string{
+				{"Name", "Phone", "Room"},
+				{"Ann", "", "101"},
+				{"Bob", "5550", "102"},
+			}),
+			[][]string{{"Name", "Phone", "Room"}, {"Ann", "", "101"}, {"Bob", "5550", "102"}},
+		},
+		{
+			"title row ignored for columns",
+			append([]ocrBox{{Text: "Quarterly report for the northern region", X: 0, Y: 0, W: 330, H: 20}},
+				tableBoxes(cols, [][]string{{}, {"Q1", "10", "yes"}, {"Q2", "20", "no"}})...),
+			[][]string{{"Quarterly report for the northern region", "", ""}, {"Q1", "10", "yes"}, {"Q2", "20", "no"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildTable(tt.boxes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGutters(t *testing.T) {
+	tests := []struct {
+		name   string
+		boxes  []ocrBox
+		tol    int
+		minGap float64
+		want   []float64
+	}{
+		{"none", []ocrBox{{X: 0, W: 100}}, 0, 10, nil},
+		{"one", []ocrBox{{X: 0, W: 40}, {X: 60, W: 40}}, 0, 10, []float64{50}},
+		{"too narrow", []ocrBox{{X: 0, W: 45}, {X: 50, W: 40}}, 0, 10, nil},
+		{"crossed once, tolerated", []ocrBox{{X: 0, W: 40}, {X: 60, W: 40}, {X: 0, W: 100}}, 1, 10, []float64{50}},
+		{"crossed once, not tolerated", []ocrBox{{X: 0, W: 40}, {X: 60, W: 40}, {X: 0, W: 100}}, 0, 10, nil},
+		{"two", []ocrBox{{X: 0, W: 40}, {X: 60, W: 40}, {X: 120, W: 10}}, 0, 10, []float64{50, 110}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gutters(tt.boxes, tt.tol, tt.minGap); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTable(t *testing.T) {
+	table := [][]string{{"Name", "Note"}, {"a|b", "say \"hi\", then\tgo"}}
+	tests := []struct {
+		mode, want string
+	}{
+		{layoutTSV, "Name\tNote\na|b\tsay \"hi\", then go"},
+		{layoutCSV, "Name,Note\na|b,\"say \"\"hi\"\", then\tgo\""},
+		{layoutMarkdown, "| Name | Note |\n| --- | --- |\n| a\\|b | say \"hi\", then\tgo |"},
+	}
+	for _, tt := range tests {
+		if got := formatTable(tt.mode, table); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =========================
+// Tesseract backend
+// =========================
+
+// tesseractBackend runs a local tesseract binary and reads its TSV output.
+type tesseractBackend struct {
+	path    string
+	args    []string // everything between the input and the "tsv" config
+	file    bool     // pass the image as a temp file instead of stdin
+	words   bool     // one box per word instead of per line
+	timeout time.Duration
+}
+
+func newTesseractBackend(c *backendConfig) (*tesseractBackend, error) {
+	b := &tesseractBackend{path: c.Path, timeout: c.timeout(60 * time.Second)}
+	if b.path == "" {
+		b.path = "tesseract"
+	}
+	switch c.Input {
+	case "", "stdin":
+	case "file":
+		b.file = true
+	default:
+		return nil, fmt.Errorf("unknown input %q (want stdin or file)", c.Input)
+	}
+	switch c.Boxes {
+	case "", "line":
+	case "word":
+		b.words = true
+	default:
+		return nil, fmt.Errorf("unknown boxes %q (want line or word)", c.Boxes)
+	}
+	if len(c.Languages) > 0 {
+		b.args = append(b.args, "-l", strings.Join(c.Languages, "+"))
+	}
+	if c.PSM != nil {
+		b.args = append(b.args, "--psm", strconv.Itoa(*c.PSM))
+	}
+	if c.OEM != nil {
+		b.args = append(b.args, "--oem", strconv.Itoa(*c.OEM))
+	}
+	b.args = append(b.args, c.Args...)
+	return b, nil
+}
+
+func (b *tesseractBackend) String() string {
+	return strings.Join(append([]string{b.path}, b.args...), " ")
+}
+
+func (b *tesseractBackend) recognize(ctx context.Context, pngBytes []byte) (*ocrResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	input := "stdin"
+	if b.file {
+		f, err := os.CreateTemp("", "ocrboard-*.png")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(pngBytes)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		input = f.Name()
+	}
+
+	args := append([]string{input, "stdout"}, b.args...)
+	cmd := exec.CommandContext(ctx, b.path, append(args, "tsv")...)
+	if !b.file {
+		cmd.Stdin = bytes.NewReader(pngBytes)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Printf("[OCR] tesseract returned: error (%.3fs)\n", elapsed.Seconds())
+		switch {
+		case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("tesseract not found (%q): install it or set the backend's path", b.path)
+		case ctx.Err() == context.DeadlineExceeded:
+			return nil, fmt.Errorf("tesseract: timed out after %s", b.timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 800 {
+			msg = msg[:800]
+		}
+		if msg != "" {
+			return nil, fmt.Errorf("tesseract: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("tesseract: %w", err)
+	}
+
+	res, err := parseTesseractTSV(stdout.String(), b.words)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract: %w", err)
+	}
+	res.Backend = "tesseract"
+	res.Latency = elapsed
+	fmt.Printf("[OCR] tesseract returned: %d boxes (%.3fs)\n", len(res.Boxes), elapsed.Seconds())
+	return res, nil
+}
+
+// tsvWord is one level-5 row of tesseract's TSV output.
+type tsvWord struct {
+	block, par, line int
+	box              ocrBox
+}
+
+// parseTesseractTSV rebuilds the text from tesseract's TSV: words joined
+// into lines, lines into paragraphs separated by a blank line. Boxes are
+// lines (or words), each with the mean word confidence.
+func parseTesseractTSV(tsv string, words bool) (*ocrResult, error) {
+	lines := strings.Split(strings.TrimRight(tsv, "\r\n"), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "level\t") {
+		return nil, fmt.Errorf("output is not TSV")
+	}
+	var ws []tsvWord
+	for i, l := range lines[1:] {
+		f := strings.Split(strings.TrimRight(l, "\r"), "\t")
+		if len(f) < 12 || f[0] != "5" {
+			continue
+		}
+		var n [11]float64
+		for j := range n {
+			v, err := strconv.ParseFloat(f[j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad number %q", i+2, f[j])
+			}
+			n[j] = v
+		}
+		text := strings.Join(f[11:], "\t")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		ws = append(ws, tsvWord{
+			block: int(n[2]), par: int(n[3]), line: int(n[4]),
+			box: ocrBox{Text: text, X: n[6], Y: n[7], W: n[8], H: n[9], Conf: n[10]},
+		})
+	}
+
+	res := &ocrResult{}
+	var text strings.Builder
+	for i := 0; i < len(ws); {
+		j := i + 1
+		for j < len(ws) && ws[j].block == ws[i].block && ws[j].par == ws[i].par && ws[j].line == ws[i].line {
+			j++
+		}
+		if i > 0 {
+			text.WriteByte('\n')
+			if ws[i].block != ws[i-1].block || ws[i].par != ws[i-1].par {
+				text.WriteByte('\n')
+			}
+		}
+		var parts []string
+		line := ws[i].box
+		conf := 0.0
+		for _, w := range ws[i:j] {
+			parts = append(parts, w.box.Text)
+			conf += w.box.Conf
+			x1 := max(line.X+line.W, w.box.X+w.box.W)
+			y1 := max(line.Y+line.H, w.box.Y+w.box.H)
+			line.X, line.Y = min(line.X, w.box.X), min(line.Y, w.box.Y)
+			line.W, line.H = x1-line.X, y1-line.Y
+			if words {
+				res.Boxes = append(res.Boxes, w.box)
+			}
+		}
+		line.Text = strings.Join(parts, " ")
+		line.Conf = conf / float64(j-i)
+		if !words {
+			res.Boxes = append(res.Boxes, line)
+		}
+		text.WriteString(line.Text)
+		i = j
+	}
+	res.Text = text.String()
+	return res, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTSV = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t400\t200\t-1\t\n" +
+	"4\t1\t1\t1\t1\t0\t10\t10\t120\t20\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t10\t10\t50\t20\t90\tHello\n" +
+	"5\t1\t1\t1\t1\t2\t70\t12\t60\t18\t80\tworld\n" +
+	"5\t1\t1\t1\t2\t1\t10\t40\t40\t20\t70\tsecond\n" +
+	"5\t1\t1\t1\t2\t2\t60\t40\t30\t20\t-1\t \n" +
+	"5\t1\t2\t1\t1\t1\t10\t100\t80\t20\t60\tnext\n"
+
+func TestParseTesseractTSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		tsv   string
+		words bool
+		text  string
+		boxes []ocrBox
+	}{
+		{"lines", testTSV, false, "Hello world\nsecond\n\nnext", []ocrBox{
+			{Text: "Hello world", X: 10, Y: 10, W: 120, H: 20, Conf: 85},
+			{Text: "second", X: 10, Y: 40, W: 40, H: 20, Conf: 70},
+			{Text: "next", X: 10, Y: 100, W: 80, H: 20, Conf: 60},
+		}},
+		{"words", testTSV, true, "Hello world\nsecond\n\nnext", []ocrBox{
+			{Text: "Hello", X: 10, Y: 10, W: 50, H: 20, Conf: 90},
+			{Text: "world", X: 70, Y: 12, W: 60, H: 18, Conf: 80},
+			{Text: "second", X: 10, Y: 40, W: 40, H: 20, Conf: 70},
+			{Text: "next", X: 10, Y: 100, W: 80, H: 20, Conf: 60},
+		}},
+		{"no words", strings.SplitAfterN(testTSV, "\n", 2)[0], false, "", nil},
+		{"crlf", strings.ReplaceAll(testTSV, "\n", "\r\n"), false, "Hello world\nsecond\n\nnext", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := parseTesseractTSV(tt.tsv, tt.words)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Text != tt.text {
+				t.Errorf("text = %q, want %q", res.Text, tt.text)
+			}
+			if tt.boxes != nil && !reflect.DeepEqual(res.Boxes, tt.boxes) {
+				t.Errorf("boxes = %+v\nwant %+v", res.Boxes, tt.boxes)
+			}
+		})
+	}
+}
+
+func TestParseTesseractTSVErrors(t *testing.T) {
+	for _, tsv := range []string{
+		"",
+		"Tesseract Open Source OCR Engine\n",
+		"level\tpage_num\n5\t1\t1\t1\t1\t1\tx\t10\t50\t20\t90\tHello\n",
+	} {
+		if _, err := parseTesseractTSV(tsv, false); err == nil {
+			t.Errorf("%q: no error", tsv)
+		}
+	}
+}
+
+// fakeTesseract writes a shell script standing in for tesseract. It saves
+// its arguments to dir/args, checks its input, then runs body.
+func fakeTesseract(t *testing.T, body string) (path, dir string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "out.tsv"), []byte(testTSV), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\n" +
+		"dir=$(dirname \"$0\")\n" +
+		"echo \"$@\" > \"$dir/args\"\n" +
+		"if [ \"$1\" = stdin ]; then cat > \"$dir/input\"; else cp \"$1\" \"$dir/input\" || exit 3; fi\n" +
+		body + "\n"
+	path = filepath.Join(dir, "tesseract")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, dir
+}
+
+func TestTesseractBackend(t *testing.T) {
+	psm := 6
+	tests := []struct {
+		name    string
+		cfg     backendConfig
+		body    string
+		args    string // prefix, the input is checked separately
+		wantErr string
+	}{
+		{"stdin", backendConfig{Languages: []string{"eng", "jpn"}, PSM: &psm},
+			`cat "$dir/out.tsv"`, "stdin stdout -l eng+jpn --psm 6 tsv", ""},
+		{"file", backendConfig{Input: "file", Args: []string{"-c", "preserve_interword_spaces=1"}},
+			`cat "$dir/out.tsv"`, "stdout -c preserve_interword_spaces=1 tsv", ""},
+		{"exit status", backendConfig{},
+			`echo "Error opening data file eng.traineddata" >&2; exit 1`, "", "Error opening data file"},
+		{"not tsv", backendConfig{},
+			`echo "Estimating resolution as 70"`, "", "output is not TSV"},
+		{"timeout", backendConfig{Timeout: duration(100 * time.Millisecond)},
+			`exec sleep 5`, "", "timed out after 100ms"},
+	}
+	png := testPNG(t, 4, 4)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, dir := fakeTesseract(t, tt.body)
+			tt.cfg.Type, tt.cfg.Path = backendTesseract, path
+			backends, err := newBackends(&tt.cfg, "default", nil, newCredentialStore(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := backends[0].recognize(context.Background(), png)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Text != "Hello world\nsecond\n\nnext" || res.Backend != "tesseract" {
+				t.Errorf("result = %q from %q", res.Text, res.Backend)
+			}
+			args, _ := os.ReadFile(filepath.Join(dir, "args"))
+			if got := strings.TrimSpace(string(args)); !strings.HasSuffix(got, tt.args) {
+				t.Errorf("args = %q, want %q", got, tt.args)
+			}
+			input, _ := os.ReadFile(filepath.Join(dir, "input"))
+			if string(input) != string(png) {
+				t.Errorf("tesseract got %d bytes of input, want the %d-byte PNG", len(input), len(png))
+			}
+		})
+	}
+}
+
+func TestTesseractNotFound(t *testing.T) {
+	c := &backendConfig{Type: backendTesseract, Path: filepath.Join(t.TempDir(), "no-tesseract")}
+	backends, err := newBackends(c, "default", nil, newCredentialStore(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = backends[0].recognize(context.Background(), testPNG(t, 4, 4))
+	if err == nil || !strings.Contains(err.Error(), "tesseract not found") {
+		t.Errorf("err = %v", err)
+	}
+}
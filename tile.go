@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// =========================
+// Tiled OCR (large selections)
+// =========================
+
+const tileOverlap = 48 // px shared by strips cut through text
+
+type tileOptions struct {
+	maxHeight int // strips are at most this tall; 0 disables tiling
+	overlap   int // extra rows on each side of a cut that misses whitespace
+}
+
+// strip is one horizontal band [top, bottom) of the crop. overlap reports
+// whether it shares rows with the previous strip (a hard cut through text).
+type strip struct {
+	top, bottom int
+	overlap     bool
+}
+
+// blankRows builds a projection profile of the image: a row is blank when
+// almost none of its pixels differ from the dominant background luminance.
+func blankRows(img *image.RGBA) []bool {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			hist[luma(row[x*4:])]++
+		}
+	}
+	bg := 0
+	for v := range hist {
+		if hist[v] > hist[bg] {
+			bg = v
+		}
+	}
+
+	const inkDelta = 48
+	tol := w / 400
+	blank := make([]bool, h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		ink := 0
+		for x := 0; x < w; x++ {
+			d := int(luma(row[x*4:])) - bg
+			if d > inkDelta || d < -inkDelta {
+				ink++
+			}
+		}
+		blank[y] = ink <= tol
+	}
+	return blank
+}
+
+func luma(p []byte) uint8 {
+	return uint8((299*uint32(p[0]) + 587*uint32(p[1]) + 114*uint32(p[2])) / 1000)
+}
+
+// planStrips cuts a column of rows into strips no taller than maxHeight,
+// shared rows included. Each cut goes through the middle of the widest
+// whitespace gap in the lower half of the window; when there is none, the
+// cut is hard and the neighbouring strips overlap so every text line is
+// whole in one of them.
+func planStrips(blank []bool, opts tileOptions) []strip {
+	h := len(blank)
+	if opts.maxHeight <= 0 || h <= opts.maxHeight {
+		return []strip{{top: 0, bottom: h}}
+	}
+	ov := min(opts.overlap, opts.maxHeight/4) // leaves room to advance
+
+	var strips []strip
+	top, overlap := 0, false
+	for {
+		if h-top <= opts.maxHeight {
+			strips = append(strips, strip{top: top, bottom: h, overlap: overlap})
+			return strips
+		}
+
+		lo, hi := top+opts.maxHeight/2, top+opts.maxHeight
+		bestLen, bestMid := 0, -1
+		for y := lo; y < hi; {
+			if !blank[y] {
+				y++
+				continue
+			}
+			end := y
+			for end < hi && blank[end] {
+				end++
+			}
+			if end-y >= bestLen {
+				bestLen, bestMid = end-y, (y+end)/2
+			}
+			y = end
+		}
+
+		if bestMid >= 0 {
+			strips = append(strips, strip{top: top, bottom: bestMid, overlap: overlap})
+			top, overlap = bestMid, false
+			continue
+		}
+
+		// The strip ends ov rows past the cut and the next one starts ov
+		// rows before it.
+		cut := hi - ov
+		strips = append(strips, strip{top: top, bottom: hi, overlap: overlap})
+		top, overlap = cut-ov, ov > 0
+	}
+}
+
+// ocrTiled OCRs img directly when it is small enough, otherwise it splits
+// it into strips, OCRs them concurrently through the pool and merges the
+// results back in reading order.
+func ocrTiled(ctx context.Context, pool *backendPool, img *image.RGBA, opts tileOptions) (*ocrResult, error) {
+	strips := planStrips(blankRows(img), opts)
+	if len(strips) == 1 {
+		pngBytes, err := encodePNG(img)
+		if err != nil {
+			return nil, err
+		}
+		return pool.recognize(ctx, pngBytes)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	b := img.Bounds()
+	results := make([]*ocrResult, len(strips))
+	errs := make([]error, len(strips))
+	var wg sync.WaitGroup
+	for i, s := range strips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := img.SubImage(image.Rect(b.Min.X, b.Min.Y+s.top, b.Max.X, b.Min.Y+s.bottom))
+			pngBytes, err := encodePNG(sub)
+			if err == nil {
+				results[i], err = pool.recognize(ctx, pngBytes)
+			}
+			if err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Report the strip that failed, not the ones canceled because of it.
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	texts := make([]string, len(results))
+	var backends []string
+	var tokens tokenUsage
+	for i, r := range results {
+		texts[i] = r.Text
+		if !slices.Contains(backends, r.Backend) {
+			backends = append(backends, r.Backend)
+		}
+		tokens = tokens.add(r.Tokens)
+	}
+	return &ocrResult{
+		Text:    mergeStripTexts(strips, texts),
+		Boxes:   mergeStripBoxes(strips, results),
+		Backend: strings.Join(backends, ", "),
+		Latency: time.Since(start),
+		Tokens:  tokens,
+	}, nil
+}
+
+// mergeStripBoxes moves boxes into crop coordinates. Inside an overlap,
+// each box is kept only from the strip that owns its centre: the upper
+// strip above the middle of the shared rows, the lower one below it.
+func mergeStripBoxes(strips []strip, results []*ocrResult) []ocrBox {
+	var out []ocrBox
+	for i, s := range strips {
+		ownTop, ownBottom := float64(s.top), float64(s.bottom)
+		if s.overlap {
+			ownTop = float64(s.top+strips[i-1].bottom) / 2
+		}
+		if i+1 < len(strips) && strips[i+1].overlap {
+			ownBottom = float64(strips[i+1].top+s.bottom) / 2
+		}
+		for _, bx := range results[i].Boxes {
+			bx.Y += float64(s.top)
+			if cy := bx.Y + bx.H/2; cy < ownTop || cy >= ownBottom {
+				continue
+			}
+			out = append(out, bx)
+		}
+	}
+	return out
+}
+
+// mergeStripTexts joins strip results top to bottom. Where two strips
+// overlap, the run of lines both of them read is kept once, together with
+// the partial lines on either side of it.
+func mergeStripTexts(strips []strip, texts []string) string {
+	var out []string
+	for i, t := range texts {
+		lines := strings.Split(strings.TrimRight(t, "\n"), "\n")
+		if t == "" {
+			lines = nil
+		}
+		if i > 0 && strips[i].overlap {
+			out = mergeOverlap(out, lines)
+			continue
+		}
+		out = append(out, lines...)
+	}
+	return strings.Join(out, "\n")
+}
+
+const overlapWindow = 8 // lines at a strip edge searched for duplicates
+
+// mergeOverlap aligns the tail of prev with the head of next. Only one
+// partial line may sit past the shared run on either side: the line the
+// cut went through.
+func mergeOverlap(prev, next []string) []string {
+	bestRun, bestI, bestJ := 0, 0, 0
+	for i := max(0, len(prev)-overlapWindow); i < len(prev); i++ {
+		for j := 0; j < len(next) && j <= 1; j++ {
+			run := 0
+			for i+run < len(prev) && j+run < len(next) && similarLine(prev[i+run], next[j+run]) {
+				run++
+			}
+			if run > 0 && i+run >= len(prev)-1 && run > bestRun {
+				bestRun, bestI, bestJ = run, i, j
+			}
+		}
+	}
+	if bestRun == 0 {
+		return append(prev, next...)
+	}
+	return append(prev[:bestI+bestRun], next[bestJ+bestRun:]...)
+}
+
+// similarLine reports whether two OCR lines are the same text read twice,
+// tolerating small recognition differences on lines long enough for a
+// near match to mean anything.
+func similarLine(a, b string) bool {
+	a = normalizeLine(a)
+	b = normalizeLine(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	n := max(utf8.RuneCountInString(a), utf8.RuneCountInString(b))
+	if n < 10 {
+		return false
+	}
+	return editDistance(a, b)*5 <= n
+}
+
+func normalizeLine(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// editDistance is the Levenshtein distance between two strings, in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// blankProfile builds a projection profile: '.' rows are blank, '#' rows
+// have ink, each repeated n times.
+func blankProfile(pattern string, n int) []bool {
+	var out []bool
+	for _, c := range pattern {
+		for range n {
+			out = append(out, c == '.')
+		}
+	}
+	return out
+}
+
+func TestPlanStrips(t *testing.T) {
+	tests := []struct {
+		name  string
+		blank []bool
+		opts  tileOptions
+		want  []strip
+	}{
+		{"tiling off", blankProfile("####", 100), tileOptions{}, []strip{{0, 400, false}}},
+		{"fits", blankProfile("####", 100), tileOptions{maxHeight: 400, overlap: 48}, []strip{{0, 400, false}}},
+		{"cut in a gap", blankProfile("###.###", 50), tileOptions{maxHeight: 200, overlap: 20},
+			[]strip{{0, 175, false}, {175, 350, false}}},
+		{"widest gap wins", blankProfile("##.#..##", 25), tileOptions{maxHeight: 150, overlap: 20},
+			[]strip{{0, 125, false}, {125, 200, false}}},
+		{"hard cuts overlap", blankProfile("##########", 50), tileOptions{maxHeight: 200, overlap: 20},
+			[]strip{{0, 200, false}, {160, 360, true}, {320, 500, true}}},
+		{"overlap capped", blankProfile("######", 50), tileOptions{maxHeight: 100, overlap: 48},
+			[]strip{{0, 100, false}, {50, 150, true}, {100, 200, true}, {150, 250, true}, {200, 300, true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planStrips(tt.blank, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("strips = %v, want %v", got, tt.want)
+			}
+			for i, s := range got {
+				if tt.opts.maxHeight > 0 && s.bottom-s.top > tt.opts.maxHeight {
+					t.Errorf("strip %d is %d rows, over %d", i, s.bottom-s.top, tt.opts.maxHeight)
+				}
+				if i > 0 && s.top > got[i-1].bottom {
+					t.Errorf("rows %d-%d in no strip", got[i-1].bottom, s.top)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanStripsStayWithinMaxHeight(t *testing.T) {
+	// Ink everywhere except a few narrow gaps, so hard and gap cuts mix.
+	blank := blankProfile(strings.Repeat("#########.", 40), 7)
+	for _, maxHeight := range []int{64, 100, 333, 1000} {
+		strips := planStrips(blank, tileOptions{maxHeight: maxHeight, overlap: tileOverlap})
+		if strips[0].top != 0 || strips[len(strips)-1].bottom != len(blank) {
+			t.Errorf("max %d: strips %v do not cover %d rows", maxHeight, strips, len(blank))
+		}
+		for i, s := range strips {
+			if s.bottom-s.top > maxHeight || s.bottom <= s.top {
+				t.Errorf("max %d: strip %d is %v", maxHeight, i, s)
+			}
+		}
+	}
+}
+
+func TestMergeOverlap(t *testing.T) {
+	tests := []struct {
+		name       string
+		prev, next []string
+		want       []string
+	}{
+		{"no overlap", []string{"a line of text"}, []string{"another line"},
+			[]string{"a line of text", "another line"}},
+		{"shared run", []string{"one", "two", "three"}, []string{"two", "three", "four"},
+			[]string{"one", "two", "three", "four"}},
+		{"partial line each side", []string{"one", "two", "thr"}, []string{"wo", "two", "three", "four"},
+			[]string{"one", "two", "three", "four"}},
+		{"near match", []string{"first line", "The quick brown fox jumps"}, []string{"The quick brovvn fox jumps", "over the dog"},
+			[]string{"first line", "The quick brown fox jumps", "over the dog"}},
+		{"short lines must match exactly", []string{"a", "abc"}, []string{"abd", "z"},
+			[]string{"a", "abc", "abd", "z"}},
+		{"run too far from the edge", []string{"same", "x", "y", "z"}, []string{"same", "next"},
+			[]string{"same", "x", "y", "z", "same", "next"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeOverlap(append([]string(nil), tt.prev...), tt.next)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeStripBoxes(t *testing.T) {
+	strips := []strip{{0, 200, false}, {160, 360, true}, {360, 500, false}}
+	results := []*ocrResult{
+		{Boxes: []ocrBox{
+			{Text: "top", Y: 10, H: 20},
+			{Text: "shared", Y: 165, H: 20},    // centre 175, below the middle (180)
+			{Text: "cut upper", Y: 185, H: 15}, // centre 192.5: the lower strip owns it
+		}},
+		{Boxes: []ocrBox{
+			{Text: "shared", Y: 5, H: 20},       // 165..185, centre 175: the upper strip owns it
+			{Text: "cut lower", Y: 25, H: 20},   // 185..205
+			{Text: "middle", Y: 100, H: 20},     // 260
+			{Text: "bottom edge", Y: 190, H: 8}, // 350..358
+		}},
+		{Boxes: []ocrBox{{Text: "last", Y: 10, H: 20}}},
+	}
+	var got []string
+	for _, b := range mergeStripBoxes(strips, results) {
+		got = append(got, fmt.Sprintf("%s@%g", b.Text, b.Y))
+	}
+	want := []string{"top@10", "shared@165", "cut lower@185", "middle@260", "bottom edge@350", "last@370"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("boxes = %q, want %q", got, want)
+	}
+}
+
+func TestMergeStripTexts(t *testing.T) {
+	strips := []strip{{0, 200, false}, {160, 360, true}, {360, 500, false}}
+	texts := []string{"alpha\nbravo\ncharl", "bravo\ncharlie\ndelta\n", "echo"}
+	if got, want := mergeStripTexts(strips, texts), "alpha\nbravo\ncharlie\ndelta\necho"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
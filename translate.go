@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =========================
+// Translation
+// =========================
+
+// Translation drivers.
+const (
+	translateLibre  = "libretranslate" // LibreTranslate /translate API
+	translateOpenAI = "openai"         // OpenAI-compatible chat completions
+)
+
+// Translation outputs.
+const (
+	translateOnly = "translation" // the translation replaces the text (default)
+	translateBoth = "both"        // original, a blank line, the translation
+)
+
+// translateConfig is the per-profile "translate" section.
+type translateConfig struct {
+	Driver  string   `json:"driver"`
+	URL     string   `json:"url"`
+	Model   string   `json:"model,omitempty"`  // openai
+	Source  string   `json:"source,omitempty"` // default "auto"
+	Target  string   `json:"target"`
+	Output  string   `json:"output,omitempty"`
+	Timeout duration `json:"timeout,omitempty"` // default 30s
+	Cache   int      `json:"cache,omitempty"`   // translations kept in memory, default 256; -1 disables
+
+	// Credentials, as for backends; APIKey is LibreTranslate's api_key.
+	// All are secret references.
+	APIKey  string            `json:"api_key,omitempty"`
+	Auth    *authConfig       `json:"auth,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// translateDriver translates one text. detected is the source language the
+// service recognized, if it reports one.
+type translateDriver interface {
+	translate(ctx context.Context, text, source, target string) (translated, detected string, err error)
+}
+
+// translation is the compiled translate stage of one profile.
+type translation struct {
+	driver  translateDriver
+	name    string
+	source  string
+	target  string
+	output  string
+	timeout time.Duration
+	cache   *translateCache
+}
+
+func (c *translateConfig) compile(creds *credentialStore) (*translation, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	if c.Target == "" {
+		return nil, fmt.Errorf("missing target language")
+	}
+	t := &translation{
+		name:    c.Driver,
+		source:  c.Source,
+		target:  c.Target,
+		output:  c.Output,
+		timeout: 30 * time.Second,
+	}
+	if t.source == "" {
+		t.source = "auto"
+	}
+	switch t.output {
+	case "":
+		t.output = translateOnly
+	case translateOnly, translateBoth:
+	default:
+		return nil, fmt.Errorf("unknown output %q (want translation or both)", c.Output)
+	}
+	if c.Timeout > 0 {
+		t.timeout = time.Duration(c.Timeout)
+	}
+	auth, err := newHTTPAuth(c.Auth, c.Headers, creds)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Driver {
+	case translateLibre:
+		t.driver = &libreTranslate{url: c.URL, apiKey: c.APIKey, creds: creds, auth: auth, client: &http.Client{}}
+	case translateOpenAI:
+		if c.Model == "" {
+			return nil, fmt.Errorf("openai driver needs a model")
+		}
+		if c.APIKey != "" {
+			return nil, fmt.Errorf("api_key is for libretranslate; use auth for openai")
+		}
+		t.driver = &chatTranslate{url: c.URL, model: c.Model, auth: auth, client: &http.Client{}}
+	default:
+		return nil, fmt.Errorf("unknown driver %q (want libretranslate or openai)", c.Driver)
+	}
+	switch {
+	case c.Cache == 0:
+		t.cache = newTranslateCache(256)
+	case c.Cache > 0:
+		t.cache = newTranslateCache(c.Cache)
+	}
+	return t, nil
+}
+
+// apply translates the text of res. Boxes keep the original text. When
+// the service fails, the error is logged and res keeps its text: the OCR
+// result is still worth having.
+func (t *translation) apply(ctx context.Context, res *ocrResult) {
+	if t == nil || strings.TrimSpace(res.Text) == "" {
+		return
+	}
+	key := t.source + "\x00" + t.target + "\x00" + res.Text
+	translated, ok := t.cache.get(key)
+	if ok {
+		fmt.Printf("[OCR] Translate (%s): cached\n", t.name)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+		start := time.Now()
+		var detected string
+		var err error
+		translated, detected, err = t.driver.translate(ctx, res.Text, t.source, t.target)
+		if err != nil {
+			fmt.Printf("[OCR] Translate (%s) failed, keeping the original text: %v\n", t.name, err)
+			return
+		}
+		from := t.source
+		if detected != "" {
+			from = detected
+		}
+		fmt.Printf("[OCR] Translate (%s): %s -> %s (%.3fs)\n", t.name, from, t.target, time.Since(start).Seconds())
+		t.cache.put(key, translated)
+	}
+
+	if t.output == translateBoth {
+		res.Text = res.Text + "\n\n" + translated
+	} else {
+		res.Text = translated
+	}
+}
+
+// libretranslate
+
+type libreTranslate struct {
+	url    string
+	apiKey string // secret reference, resolved per request
+	creds  *credentialStore
+	auth   *httpAuth
+	client *http.Client
+}
+
+func (d *libreTranslate) translate(ctx context.Context, text, source, target string) (string, string, error) {
+	var out struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage *struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+		Error string `json:"error"`
+	}
+	in := map[string]string{"q": text, "source": source, "target": target, "format": "text"}
+	auth := d.auth
+	if d.apiKey != "" {
+		key, err := d.creds.resolve(d.apiKey)
+		if err != nil {
+			return "", "", fmt.Errorf("api_key: %w", err)
+		}
+		in["api_key"] = key
+		if auth, err = auth.withSecret(key); err != nil {
+			return "", "", err
+		}
+	}
+	if err := postJSON(ctx, d.client, auth, d.url, in, &out); err != nil {
+		return "", "", err
+	}
+	if out.Error != "" {
+		return "", "", fmt.Errorf("%s", out.Error)
+	}
+	detected := ""
+	if out.DetectedLanguage != nil {
+		detected = out.DetectedLanguage.Language
+	}
+	return out.TranslatedText, detected, nil
+}
+
+// openai
+
+type chatTranslate struct {
+	url    string
+	model  string
+	auth   *httpAuth
+	client *http.Client
+}
+
+func (d *chatTranslate) translate(ctx context.Context, text, source, target string) (string, string, error) {
+	from := "from " + source + " "
+	if source == "auto" {
+		from = "" // the model detects it
+	}
+	system := fmt.Sprintf("Translate the user's text %sinto %s. Keep line breaks and formatting. "+
+		"Output only the translation, without comments.", from, target)
+	var out chatResponse
+	err := postJSON(ctx, d.client, d.auth, d.url, chatRequest{
+		Model: d.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: text},
+		},
+	}, &out)
+	if err != nil {
+		return "", "", err
+	}
+	if out.Error != nil {
+		return "", "", fmt.Errorf("%s", d.auth.scrub(out.Error.Message))
+	}
+	if len(out.Choices) == 0 {
+		return "", "", fmt.Errorf("no choices in response")
+	}
+	translated, err := chatContent(out.Choices[0].Message.Content)
+	return strings.TrimSpace(translated), "", err
+}
+
+// postJSON posts in as JSON with auth's credentials and decodes the
+// response into out. Errors have the secrets scrubbed.
+func postJSON(ctx context.Context, client *http.Client, auth *httpAuth, url string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if err := auth.apply(req); err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return auth.scrubErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 800))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, auth.scrub(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// translateCache is a small LRU of translations. A nil cache stores
+// nothing.
+type translateCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // front: most recently used
+	items map[string]*list.Element
+}
+
+type cacheItem struct {
+	key, value string
+}
+
+func newTranslateCache(max int) *translateCache {
+	return &translateCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *translateCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheItem).value, true
+}
+
+func (c *translateCache) put(key, value string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*cacheItem).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheItem{key, value})
+	if c.order.Len() > c.max {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*cacheItem).key)
+	}
+}
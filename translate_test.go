@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTranslation(t *testing.T) {
+	t.Setenv("OCR_TEST_LIBRE_KEY", "libre-key-42")
+	t.Setenv("OCR_TEST_TOKEN", "sk-test-123")
+
+	tests := []struct {
+		name     string
+		cfg      translateConfig
+		handler  func(t *testing.T, r *http.Request) (int, string)
+		want     string
+		requests int // for two applies of the same text
+	}{
+		{
+			name: "libretranslate with api_key",
+			cfg:  translateConfig{Driver: translateLibre, Target: "en", APIKey: "env:OCR_TEST_LIBRE_KEY"},
+			handler: func(t *testing.T, r *http.Request) (int, string) {
+				var in map[string]string
+				json.NewDecoder(r.Body).Decode(&in)
+				if in["api_key"] != "libre-key-42" || in["q"] != "Hallo Welt" || in["source"] != "auto" || in["target"] != "en" {
+					t.Errorf("request = %v", in)
+				}
+				return 200, `{"translatedText":"Hello world","detectedLanguage":{"language":"de"}}`
+			},
+			want:     "Hello world",
+			requests: 1,
+		},
+		{
+			name: "openai with bearer token, both",
+			cfg: translateConfig{Driver: translateOpenAI, Model: "m", Source: "de", Target: "en", Output: translateBoth,
+				Auth: &authConfig{Type: authBearer, Token: "env:OCR_TEST_TOKEN"}},
+			handler: func(t *testing.T, r *http.Request) (int, string) {
+				if got := r.Header.Get("Authorization"); got != "Bearer sk-test-123" {
+					t.Errorf("Authorization = %q", got)
+				}
+				return 200, `{"choices":[{"message":{"content":" Hello world\n"}}]}`
+			},
+			want:     "Hallo Welt\n\nHello world",
+			requests: 1,
+		},
+		{
+			name: "cache off",
+			cfg:  translateConfig{Driver: translateLibre, Target: "en", Cache: -1},
+			handler: func(t *testing.T, r *http.Request) (int, string) {
+				return 200, `{"translatedText":"Hello world"}`
+			},
+			want:     "Hello world",
+			requests: 2,
+		},
+		{
+			name: "service error keeps the text",
+			cfg:  translateConfig{Driver: translateLibre, Target: "en", APIKey: "env:OCR_TEST_LIBRE_KEY"},
+			handler: func(t *testing.T, r *http.Request) (int, string) {
+				return 403, `{"error":"invalid api_key libre-key-42"}`
+			},
+			want:     "Hallo Welt",
+			requests: 2, // failures are not cached
+		},
+		{
+			name: "error field keeps the text",
+			cfg:  translateConfig{Driver: translateOpenAI, Model: "m", Target: "en"},
+			handler: func(t *testing.T, r *http.Request) (int, string) {
+				return 200, `{"error":{"message":"model not found"}}`
+			},
+			want:     "Hallo Welt",
+			requests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n.Add(1)
+				code, body := tt.handler(t, r)
+				w.WriteHeader(code)
+				w.Write([]byte(body))
+			}))
+			defer srv.Close()
+
+			tt.cfg.URL = srv.URL
+			tr, err := tt.cfg.compile(newCredentialStore(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 2 {
+				res := &ocrResult{Text: "Hallo Welt"}
+				tr.apply(context.Background(), res)
+				if res.Text != tt.want {
+					t.Errorf("text = %q, want %q", res.Text, tt.want)
+				}
+			}
+			if int(n.Load()) != tt.requests {
+				t.Errorf("%d requests, want %d", n.Load(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestPostJSONScrubs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("bad token " + strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")))
+	}))
+	defer srv.Close()
+
+	t.Setenv("OCR_TEST_TOKEN", "sk-test-123")
+	auth, err := newHTTPAuth(&authConfig{Type: authBearer, Token: "env:OCR_TEST_TOKEN"}, nil, newCredentialStore(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth, err = auth.withSecret("libre-key-42"); err != nil {
+		t.Fatal(err)
+	}
+	var out struct{}
+	err = postJSON(context.Background(), srv.Client(), auth, srv.URL, map[string]string{}, &out)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if strings.Contains(err.Error(), "sk-test-123") || !strings.Contains(err.Error(), "[REDACTED]") {
+		t.Errorf("error not scrubbed: %v", err)
+	}
+}
+
+func TestTranslateConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  translateConfig
+	}{
+		{"no url", translateConfig{Driver: translateLibre, Target: "en"}},
+		{"no target", translateConfig{Driver: translateLibre, URL: "http://x"}},
+		{"bad output", translateConfig{Driver: translateLibre, URL: "http://x", Target: "en", Output: "side"}},
+		{"bad driver", translateConfig{Driver: "deepl", URL: "http://x", Target: "en"}},
+		{"openai without model", translateConfig{Driver: translateOpenAI, URL: "http://x", Target: "en"}},
+		{"api_key on openai", translateConfig{Driver: translateOpenAI, URL: "http://x", Model: "m", Target: "en", APIKey: "k"}},
+		{"bad auth type", translateConfig{Driver: translateLibre, URL: "http://x", Target: "en", Auth: &authConfig{Type: "oauth"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cfg.compile(newCredentialStore("")); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
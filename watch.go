@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+// =========================
+// Region watch (change detection)
+// =========================
+
+// frameSource yields successive captures of one region.
+type frameSource interface {
+	grab() (*image.RGBA, error)
+}
+
+// frameDiff is the fraction of pixels whose luminance differs by more than
+// a small tolerance. Frames of different sizes count as fully changed.
+func frameDiff(a, b *image.RGBA) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return 1
+	}
+	w, h := ab.Dx(), ab.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	const tol = 24
+	changed := 0
+	for y := 0; y < h; y++ {
+		ra := a.Pix[a.PixOffset(ab.Min.X, ab.Min.Y+y):]
+		rb := b.Pix[b.PixOffset(bb.Min.X, bb.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			d := int(luma(ra[x*4:])) - int(luma(rb[x*4:]))
+			if d > tol || d < -tol {
+				changed++
+			}
+		}
+	}
+	return float64(changed) / float64(w*h)
+}
+
+// duration is a time.Duration written as "2s" / "500ms" in the config.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"2s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type watchConfig struct {
+	Interval  duration `json:"interval,omitempty"`  // time between captures
+	Threshold float64  `json:"threshold,omitempty"` // changed-pixel fraction that counts as a change
+	Settle    int      `json:"settle,omitempty"`    // stable captures required before OCR
+}
+
+func (c *watchConfig) withDefaults() watchConfig {
+	out := watchConfig{Interval: duration(2 * time.Second), Threshold: 0.001, Settle: 1}
+	if c == nil {
+		return out
+	}
+	if c.Interval > 0 {
+		out.Interval = c.Interval
+	}
+	if c.Threshold > 0 {
+		out.Threshold = c.Threshold
+	}
+	if c.Settle > 0 {
+		out.Settle = c.Settle
+	}
+	return out
+}
+
+// watchEvent is emitted whenever the OCR'd text of the region changes.
+type watchEvent struct {
+	Time   time.Time
+	Result *ocrResult
+}
+
+// watcher re-captures a region and OCRs it only when the pixels changed and
+// have been stable for cfg.Settle captures, so animations and text being
+// typed do not trigger a request per frame.
+type watcher struct {
+	src  frameSource
+	cfg  watchConfig
+	now  func() time.Time
+	ocr  func(ctx context.Context, img *image.RGBA) (*ocrResult, error)
+	emit func(watchEvent)
+
+	prev     *image.RGBA // previous capture
+	stable   int         // consecutive captures equal to prev
+	lastOCR  *image.RGBA // capture the current text was read from
+	lastText string
+}
+
+// step performs one capture; it reports whether OCR ran.
+func (w *watcher) step(ctx context.Context) (bool, error) {
+	img, err := w.src.grab()
+	if err != nil {
+		return false, err
+	}
+
+	if w.prev != nil && frameDiff(img, w.prev) <= w.cfg.Threshold {
+		w.stable++
+	} else {
+		w.stable = 0
+	}
+	w.prev = img
+
+	if w.lastOCR != nil && frameDiff(img, w.lastOCR) <= w.cfg.Threshold {
+		return false, nil
+	}
+	if w.stable < w.cfg.Settle {
+		return false, nil
+	}
+
+	res, err := w.ocr(ctx, img)
+	if err != nil {
+		return true, err
+	}
+	w.lastOCR = img
+	if normalizeText(res.Text) == normalizeText(w.lastText) {
+		return true, nil
+	}
+	w.lastText = res.Text
+	w.emit(watchEvent{Time: w.now(), Result: res})
+	return true, nil
+}
+
+func normalizeText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// run steps the watcher every interval until ctx is canceled. Errors are
+// passed to onErr and do not stop the watch.
+func (w *watcher) run(ctx context.Context, onErr func(error)) {
+	t := time.NewTicker(time.Duration(w.cfg.Interval))
+	defer t.Stop()
+	for {
+		if _, err := w.step(ctx); err != nil && ctx.Err() == nil {
+			onErr(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeScreen plays back a script of screens, one per grab, and advances a
+// fake clock by tick on every grab. Each distinct screen name is drawn as
+// its own grey level, and ocr reads the name back from the pixels.
+type fakeScreen struct {
+	script []string
+	tick   time.Duration
+	clock  time.Time
+	grabs  int
+	ocrs   int
+	fail   map[int]bool // OCR calls (1-based) that fail
+	greys  map[string]uint8
+	names  map[uint8]string
+}
+
+func newFakeScreen(tick time.Duration, script ...string) *fakeScreen {
+	s := &fakeScreen{script: script, tick: tick, clock: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		greys: make(map[string]uint8), names: make(map[uint8]string)}
+	for _, name := range script {
+		if _, ok := s.greys[name]; !ok {
+			g := uint8(len(s.greys) * 40)
+			s.greys[name], s.names[g] = g, name
+		}
+	}
+	return s
+}
+
+func (s *fakeScreen) grab() (*image.RGBA, error) {
+	if s.grabs > 0 {
+		s.clock = s.clock.Add(s.tick)
+	}
+	g := s.greys[s.script[s.grabs]]
+	s.grabs++
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = g
+		if i%4 == 3 {
+			img.Pix[i] = 0xFF
+		}
+	}
+	return img, nil
+}
+
+func (s *fakeScreen) now() time.Time { return s.clock }
+
+func (s *fakeScreen) read(_ context.Context, img *image.RGBA) (string, error) {
+	s.ocrs++
+	if s.fail[s.ocrs] {
+		return "", errors.New("backend down")
+	}
+	return s.names[img.RGBAAt(0, 0).R], nil
+}
+
+func TestWatcherStep(t *testing.T) {
+	tests := []struct {
+		name   string
+		settle int
+		script []string
+		fail   map[int]bool
+		ocrs   int
+		events []string
+		times  []int // event times in ticks
+	}{
+		{"change then stable", 1, []string{"A", "A", "A", "B", "B", "B"}, nil, 2, []string{"A", "B"}, []int{1, 4}},
+		{"same text new pixels", 1, []string{"A", "A", "A2", "A2"}, nil, 2, []string{"A"}, []int{1}},
+		{"settle waits", 2, []string{"A", "A", "A", "B", "A", "B", "B", "B"}, nil, 2, []string{"A", "B"}, []int{2, 7}},
+		{"flicker back to read text", 1, []string{"A", "A", "B", "A", "A"}, nil, 1, []string{"A"}, []int{1}},
+		{"error retried", 1, []string{"A", "A", "A"}, map[int]bool{1: true}, 2, []string{"A"}, []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeScreen(time.Second, tt.script...)
+			s.fail = tt.fail
+			start := s.now()
+			var events []string
+			var times []int
+			w := &watcher{
+				src: s,
+				cfg: watchConfig{Interval: duration(time.Second), Threshold: 0.001, Settle: tt.settle},
+				now: s.now,
+				ocr: func(ctx context.Context, img *image.RGBA) (*ocrResult, error) {
+					text, err := s.read(ctx, img)
+					if text == "A2" { // drawn differently, reads the same
+						text = "A"
+					}
+					if err != nil {
+						return nil, err
+					}
+					return &ocrResult{Text: text}, nil
+				},
+				emit: func(e watchEvent) {
+					events = append(events, e.Result.Text)
+					times = append(times, int(e.Time.Sub(start)/time.Second))
+				},
+			}
+			var errs int
+			for range tt.script {
+				if _, err := w.step(context.Background()); err != nil {
+					errs++
+				}
+			}
+			if errs != len(tt.fail) {
+				t.Errorf("%d errors, want %d", errs, len(tt.fail))
+			}
+			if s.ocrs != tt.ocrs {
+				t.Errorf("%d OCR calls, want %d", s.ocrs, tt.ocrs)
+			}
+			if !reflect.DeepEqual(events, tt.events) || !reflect.DeepEqual(times, tt.times) {
+				t.Errorf("events %v at %v, want %v at %v", events, times, tt.events, tt.times)
+			}
+		})
+	}
+}
+
+func TestFrameDiff(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	b := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for i := 0; i < 10; i++ {
+		b.SetRGBA(i, 0, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	tests := []struct {
+		name string
+		a, b *image.RGBA
+		want float64
+	}{
+		{"equal", a, a, 0},
+		{"one row", a, b, 0.1},
+		{"size", a, image.NewRGBA(image.Rect(0, 0, 5, 5)), 1},
+	}
+	for _, tt := range tests {
+		if got := frameDiff(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: got %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}